@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"./tlsutil"
+)
+
+// certgen creates in a directory a development CA, if it does not exist
+// yet, and a certificate signed by it for the hosts given
+// Usage: certgen [-dir certs] [-name server] [-days 365] [host ...]
+func certgen(args []string) error {
+	flags := flag.NewFlagSet("certgen", flag.ContinueOnError)
+	dir := flags.String("dir", "certs", "directory of the PEM files")
+	name := flags.String("name", "server", "name of the certificate files")
+	days := flags.Int("days", 365, "validity of the certificates in days")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	hosts := flags.Args()
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	validFor := time.Duration(*days) * 24 * time.Hour
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	// The CA is kept so that the clients trust all its certificates
+	caCert, caKey := filepath.Join(*dir, "ca.crt"), filepath.Join(*dir, "ca.key")
+	_, certErr := os.Stat(caCert)
+	_, keyErr := os.Stat(caKey)
+	var ca *tlsutil.Cert
+	var err error
+	switch {
+	case os.IsNotExist(certErr) && os.IsNotExist(keyErr):
+		if ca, err = tlsutil.NewCA("ImpetusResel development CA", validFor); err != nil {
+			return err
+		}
+		if err = ca.WriteFiles(caCert, caKey); err != nil {
+			return err
+		}
+		fmt.Println("CA created:", caCert)
+	case os.IsNotExist(certErr) || os.IsNotExist(keyErr):
+		// * A new CA would not be trusted by the clients of the old one
+		return fmt.Errorf("certgen: only one of %s and %s exists, restore it or remove both to create a new CA", caCert, caKey)
+	default:
+		if ca, err = tlsutil.LoadFiles(caCert, caKey); err != nil {
+			return err
+		}
+	}
+
+	cert, err := ca.Issue(hosts, validFor)
+	if err != nil {
+		return err
+	}
+	certFile, keyFile := filepath.Join(*dir, *name+".crt"), filepath.Join(*dir, *name+".key")
+	if err = cert.WriteFiles(certFile, keyFile); err != nil {
+		return err
+	}
+	fmt.Printf("Certificate for %v created: %s %s\n", hosts, certFile, keyFile)
+	fmt.Printf("Serve it with: -cert %s -key %s, trust %s in the clients\n", certFile, keyFile, caCert)
+	return nil
+}
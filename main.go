@@ -1,28 +1,53 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 	"time"
 
 	"./net/http"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "certgen" {
+		if err := certgen(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	addr := flag.String("addr", ":8085", "address of the server")
+	certFile := flag.String("cert", "", "PEM certificate file, serves HTTPS with -key")
+	keyFile := flag.String("key", "", "PEM private key file")
+	flag.Parse()
+
 	fmt.Println("Welcome in ImpetusResel")
 	api := http.NewRouter()
-	api.AddRoute("/bonjour", func(w http.Headers, r *http.Request) {
-		w.SetStatusCode(200)
-		w.AddEntity(http.ContentType, "text/plain; charset=utf-8")
-		w.SetBody("Welcome you are on this page: " + r.URL)
-		fmt.Println("1 sec sleep ->", string(w.Bytes()))
+	api.AddRoute("/bonjour", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(http.ContentType, "text/plain; charset=utf-8")
+		w.WriteHeader(200)
+		w.Write([]byte("Welcome you are on this page: " + r.URL.Path))
+		fmt.Println("10 sec sleep ->", r.URL.Path)
 		time.Sleep(10 * time.Second)
 	})
-	api.SetDefaultRoute(func(w http.Headers, r *http.Request) {
-		w.SetStatusCode(404)
-		w.AddEntity(http.ContentType, "text/plain; charset=utf-8")
-		w.SetBody("Page not found\n")
+	api.SetDefaultRoute(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(http.ContentType, "text/plain; charset=utf-8")
+		w.WriteHeader(404)
+		w.Write([]byte("Page not found\n"))
 	})
-	http.ListenAndServe(8085, api)
+	srv := &http.Server{Addr: *addr, Router: api}
+	// The requests in progress have 15 seconds to finish on Ctrl-C
+	srv.ShutdownOnSignal(15 * time.Second)
+	var err error
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		fmt.Println(err)
+	}
 
 	// req, err := http.NewRequest("GET", "localhost/bonjour", []byte{}) // http://www.googleapis.com/books/v1/volumes?q=isbn:0747532699
 	// if err != nil {
@@ -0,0 +1,28 @@
+package net
+
+import "golang.org/x/sys/unix"
+
+// socketCloexec returns a TCP socket of family, close-on-exec is set
+// atomically by socket if cloexec is true
+func socketCloexec(family int, cloexec bool) (int, error) {
+	typ := unix.SOCK_STREAM
+	if cloexec {
+		typ |= unix.SOCK_CLOEXEC
+	}
+	return unix.Socket(family, typ, unix.IPPROTO_IP)
+}
+
+// pipeCloexec creates a pipe whose ends are close-on-exec
+func pipeCloexec(p []int) error {
+	return unix.Pipe2(p, unix.O_CLOEXEC)
+}
+
+// acceptCloexec accepts a connection on the listening socket fd,
+// close-on-exec is set atomically by accept4 if cloexec is true
+func acceptCloexec(fd int, cloexec bool) (int, unix.Sockaddr, error) {
+	flags := 0
+	if cloexec {
+		flags = unix.SOCK_CLOEXEC
+	}
+	return unix.Accept4(fd, flags)
+}
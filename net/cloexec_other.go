@@ -0,0 +1,111 @@
+//go:build !linux
+
+package net
+
+import (
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// * The systems without the flags of socket, pipe2 and accept4 set
+// close-on-exec after the creation of the fd: the fork lock prevents a
+// process from being executed in between
+
+// socketCloexec returns a TCP socket of family, close-on-exec is set under
+// the fork lock if cloexec is true
+func socketCloexec(family int, cloexec bool) (int, error) {
+	if !cloexec {
+		return unix.Socket(family, unix.SOCK_STREAM, unix.IPPROTO_IP)
+	}
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	fd, err := unix.Socket(family, unix.SOCK_STREAM, unix.IPPROTO_IP)
+	if err == nil {
+		unix.CloseOnExec(fd)
+	}
+	return fd, err
+}
+
+// pipeCloexec creates a pipe whose ends are close-on-exec, under the fork
+// lock as socketCloexec
+func pipeCloexec(p []int) error {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	if err := unix.Pipe(p); err != nil {
+		return err
+	}
+	unix.CloseOnExec(p[0])
+	unix.CloseOnExec(p[1])
+	return nil
+}
+
+// acceptMu serializes the accepts switching a blocking listening socket
+// to non-blocking mode, the mode read under it is the one of the socket
+var acceptMu sync.Mutex
+
+// acceptCloexec accepts a connection on the listening socket fd,
+// close-on-exec is set under the fork lock if cloexec is true
+func acceptCloexec(fd int, cloexec bool) (int, unix.Sockaddr, error) {
+	if !cloexec {
+		return unix.Accept(fd)
+	}
+	acceptMu.Lock()
+	flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFL, 0)
+	acceptMu.Unlock()
+	if err != nil {
+		return -1, nil, err
+	}
+	if flags&unix.O_NONBLOCK != 0 {
+		return acceptLocked(fd)
+	}
+	// * The lock would block the processes executed while waiting for a
+	// connection: the connection is waited for without it, then accepted
+	// without blocking. The wait starts again if another accept took it.
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		if _, err = unix.Poll(fds, -1); err == unix.EINTR {
+			continue
+		} else if err != nil {
+			return -1, nil, err
+		}
+		acceptMu.Lock()
+		nfd, sa, err := acceptNonblock(fd)
+		acceptMu.Unlock()
+		if err != unix.EAGAIN {
+			return nfd, sa, err
+		}
+	}
+}
+
+// acceptNonblock accepts a connection pending on the blocking listening
+// socket fd, unix.EAGAIN is returned if there is none
+func acceptNonblock(fd int) (int, unix.Sockaddr, error) {
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return -1, nil, err
+	}
+	nfd, sa, err := acceptLocked(fd)
+	unix.SetNonblock(fd, false)
+	if err != nil {
+		return -1, nil, err
+	}
+	// * The accepted socket inherits O_NONBLOCK on the BSD systems
+	if err = unix.SetNonblock(nfd, false); err != nil {
+		unix.Close(nfd)
+		return -1, nil, err
+	}
+	return nfd, sa, nil
+}
+
+// acceptLocked accepts a connection on fd and sets close-on-exec under
+// the fork lock
+func acceptLocked(fd int) (int, unix.Sockaddr, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	nfd, sa, err := unix.Accept(fd)
+	if err == nil {
+		unix.CloseOnExec(nfd)
+	}
+	return nfd, sa, err
+}
@@ -1,32 +1,184 @@
 package net
 
-import "golang.org/x/sys/unix"
+import (
+	"io"
+	gonet "net"
+	"sync/atomic"
+	"time"
 
-// Conn store a socket connection
+	"golang.org/x/sys/unix"
+)
+
+// Conn store a socket connection, *Conn implements io.ReadWriteCloser and
+// the net.Conn interface of the standard library so that crypto/tls can
+// be used on top of it
 type Conn struct {
 	Fd   int
 	Addr unix.Sockaddr
+
+	readDeadline int64 // deadline of Read in Unix nanoseconds, 0 if none
+}
+
+var _ gonet.Conn = (*Conn)(nil)
+
+// ErrTimeout is returned by Read and Write once the timeout or the
+// deadline of the connection has elapsed
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Read store in buf the data received from a socket connection, it returns
+// io.EOF once the peer has closed the connection
+func (c *Conn) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if deadline := atomic.LoadInt64(&c.readDeadline); deadline != 0 {
+		// * The timeout of the socket applies to each recv, it is armed
+		// with the time left so that the deadline is not pushed back
+		d := time.Until(time.Unix(0, deadline))
+		if d <= 0 {
+			return 0, ErrTimeout
+		}
+		if err := c.setRecvTimeout(d); err != nil {
+			return 0, err
+		}
+	}
+	for {
+		// * Recvfrom will read the client fd and store the data in msg
+		// Do not forger to close the fd after
+		sizeMsg, _, err := unix.Recvfrom(c.Fd, buf, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EAGAIN {
+			return 0, ErrTimeout
+		}
+		if err != nil {
+			return 0, err
+		}
+		if sizeMsg == 0 {
+			// * Recvfrom returns 0 when the peer has performed an orderly shutdown
+			return 0, io.EOF
+		}
+		return sizeMsg, nil
+	}
+}
+
+// Write sends the buf data to a socket connection, it returns once all
+// the data has been sent
+func (c *Conn) Write(buf []byte) (int, error) {
+	var written int
+	for written < len(buf) {
+		// * A stream socket is connected, no destination address is given
+		n, err := unix.SendmsgN(c.Fd, buf[written:], nil, nil, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EAGAIN {
+			return written, ErrTimeout
+		}
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// SetReadTimeout sets the maximum time a Read can wait for data, the
+// deadline set by SetReadDeadline is cleared.
+// Once elapsed Read returns ErrTimeout, a zero duration means no timeout
+func (c *Conn) SetReadTimeout(d time.Duration) error {
+	atomic.StoreInt64(&c.readDeadline, 0)
+	return c.setRecvTimeout(d)
+}
+
+func (c *Conn) setRecvTimeout(d time.Duration) error {
+	tv := unix.NsecToTimeval(d.Nanoseconds())
+	return unix.SetsockoptTimeval(c.Fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+}
+
+// SetWriteTimeout sets the maximum time a Write can wait for the data to
+// be sent, a zero duration means no timeout
+func (c *Conn) SetWriteTimeout(d time.Duration) error {
+	tv := unix.NsecToTimeval(d.Nanoseconds())
+	return unix.SetsockoptTimeval(c.Fd, unix.SOL_SOCKET, unix.SO_SNDTIMEO, &tv)
+}
+
+// timeoutUntil returns the timeout of a deadline, the zero time means no
+// deadline
+func timeoutUntil(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	d := time.Until(t)
+	if d < time.Microsecond {
+		// * A zero timeout would disable it, the deadline has passed
+		d = time.Microsecond
+	}
+	return d
+}
+
+// SetDeadline sets the read and write deadlines of the connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline makes Read return ErrTimeout after t, whatever the data
+// received before, the zero time means no deadline
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	var deadline int64
+	if !t.IsZero() {
+		deadline = t.UnixNano()
+	}
+	atomic.StoreInt64(&c.readDeadline, deadline)
+	return c.setRecvTimeout(timeoutUntil(t))
+}
+
+// SetWriteDeadline makes Write return ErrTimeout after t, the deadline is
+// approximated by a timeout of each Write
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.SetWriteTimeout(timeoutUntil(t))
+}
+
+// tcpAddr converts a socket address to the address type of the standard
+// library
+func tcpAddr(sa unix.Sockaddr) gonet.Addr {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return &gonet.TCPAddr{IP: gonet.IP(append([]byte{}, sa.Addr[:]...)), Port: sa.Port}
+	case *unix.SockaddrInet6:
+		addr := &gonet.TCPAddr{IP: gonet.IP(append([]byte{}, sa.Addr[:]...)), Port: sa.Port}
+		if sa.ZoneId != 0 {
+			if ifi, err := gonet.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return addr
+	}
+	return &gonet.TCPAddr{}
 }
 
-// Read store in buf the data received from a socket connection
-func (c *Conn) Read(buf *[]byte) (int, error) {
-	// * Recvfrom will read the client fd and store the data in msg
-	// Do not forger to close the fd after
-	sizeMsg, _, err := unix.Recvfrom(c.Fd, *buf, 0)
+// LocalAddr returns the local address of the connection
+func (c *Conn) LocalAddr() gonet.Addr {
+	sa, err := unix.Getsockname(c.Fd)
 	if err != nil {
-		return 0, err
+		return &gonet.TCPAddr{}
 	}
-	return sizeMsg, nil
+	return tcpAddr(sa)
 }
 
-// Read send the buf data to a socket connection
-func (c *Conn) Write(buf []byte) error {
-	return unix.Sendmsg(
-		c.Fd,
-		buf,
-		nil,
-		c.Addr,
-		unix.MSG_DONTWAIT)
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() gonet.Addr {
+	return tcpAddr(c.Addr)
 }
 
 // Close closes the fd of a socket connection
@@ -2,78 +2,166 @@ package net
 
 import (
 	"fmt"
+	gonet "net"
+	"strconv"
 
 	"golang.org/x/sys/unix"
-
-	"../utils"
-)
-
-const (
-	listenBacklog = 100
 )
 
+// TCPServer is a listening socket
 type TCPServer struct {
-	Fd       int
-	AddrIPv4 *unix.SockaddrInet4
+	Fd   int
+	Addr unix.Sockaddr // *unix.SockaddrInet4 or *unix.SockaddrInet6
+
+	config ListenConfig // options of the socket and the accepted connections
 }
 
-func initSockAddr(addr string, port int) *unix.SockaddrInet4 {
-	tmpAddr := ParseIP(addr)
-	if tmpAddr == nil {
-		tmpAddr = IP{127, 0, 0, 1}
+// zoneIndex returns the index of the network interface of an IPv6 zone,
+// the zone is an interface name or an index
+func zoneIndex(zone string) (uint32, error) {
+	if zone == "" {
+		return 0, nil
 	}
-	return &unix.SockaddrInet4{
-		Port: port,
-		Addr: [4]byte{tmpAddr[0], tmpAddr[1], tmpAddr[2], tmpAddr[3]},
+	if n, err := strconv.ParseUint(zone, 10, 32); err == nil {
+		return uint32(n), nil
 	}
+	ifi, err := gonet.InterfaceByName(zone)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(ifi.Index), nil
 }
 
-func initTCPServer(addr string, port int) TCPServer {
-	return TCPServer{
-		Fd:       0,
-		AddrIPv4: initSockAddr(addr, port),
+// sockaddr returns the socket address of ip and port and its family,
+// AF_INET for an IPv4 address, AF_INET6 for an IPv6 address
+func sockaddr(ip IP, zone string, port int) (unix.Sockaddr, int, error) {
+	switch len(ip) {
+	case IPv4len:
+		sa := &unix.SockaddrInet4{Port: port}
+		copy(sa.Addr[:], ip)
+		return sa, unix.AF_INET, nil
+	case IPv6len:
+		index, err := zoneIndex(zone)
+		if err != nil {
+			return nil, 0, err
+		}
+		sa := &unix.SockaddrInet6{Port: port, ZoneId: index}
+		copy(sa.Addr[:], ip)
+		return sa, unix.AF_INET6, nil
 	}
+	return nil, 0, fmt.Errorf("%v is not an IP address", []byte(ip))
 }
 
-func (s *TCPServer) socket() error {
+// SockaddrString returns the address and the port of sa, the IPv6
+// addresses are between brackets "[::1]:80"
+func SockaddrString(sa unix.Sockaddr) string {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return IP(sa.Addr[:]).String() + ":" + strconv.Itoa(sa.Port)
+	case *unix.SockaddrInet6:
+		host := IP(sa.Addr[:]).String()
+		if sa.ZoneId != 0 {
+			host += "%" + strconv.Itoa(int(sa.ZoneId))
+		}
+		return "[" + host + "]:" + strconv.Itoa(sa.Port)
+	}
+	return "?"
+}
+
+func (s *TCPServer) socket(family int) error {
 	var err error
 	// * Socket will return the server socket file descriptor
-	s.Fd, err = unix.Socket(unix.AF_INET, unix.SOCK_STREAM, unix.IPPROTO_IP)
+	s.Fd, err = socketCloexec(family, s.config.CloseOnExec)
 	return err
 }
 
 func (s *TCPServer) Listen() error {
 	// * Listen will set sockfd as a passive socket ready to accept
 	// incoming connection request
-	return unix.Listen(s.Fd, listenBacklog)
+	return unix.Listen(s.Fd, s.config.backlog())
 }
 
 // Dial creates the TCP connection, link the given address and port
 // and start to listen
 func Dial(port int) (TCPServer, error) {
-	s := initTCPServer("127.0.0.1", port)
-	err := s.socket()
+	return DialAddr("127.0.0.1", port)
+}
+
+// DialAddr creates the TCP socket bound to the IPv4 or IPv6 address addr,
+// a zone can follow an IPv6 address "fe80::1%eth0". An IPv6 socket also
+// accepts the IPv4 connections: "::" listens on every address of both
+// families.
+func DialAddr(addr string, port int) (TCPServer, error) {
+	ip, zone := ParseIPZone(addr)
+	if ip == nil {
+		return TCPServer{}, fmt.Errorf("%q is not a valid IP address", addr)
+	}
+	return bind(ip, zone, port, ListenConfig{})
+}
+
+// bind creates the TCP socket with the options of config and binds it to
+// ip and port
+func bind(ip IP, zone string, port int, config ListenConfig) (TCPServer, error) {
+	sa, family, err := sockaddr(ip, zone, port)
 	if err != nil {
+		return TCPServer{}, err
+	}
+	s := TCPServer{Addr: sa, config: config}
+	if err = s.socket(family); err != nil {
 		return TCPServer{}, fmt.Errorf("socket: %s", err.Error())
 	}
+	if err = s.setOptions(family); err != nil {
+		unix.Close(s.Fd)
+		return TCPServer{}, fmt.Errorf("setsockopt: %s", err.Error())
+	}
 	// * Bind will link a socket file descriptor to a socket address
-	err = unix.Bind(s.Fd, s.AddrIPv4)
+	err = unix.Bind(s.Fd, s.Addr)
 	if err != nil {
-		return TCPServer{}, fmt.Errorf("Failed to bind to Addr: %v, Port: %d\nReason: %s", utils.ByteArrayJoin(s.AddrIPv4.Addr[:], "."), s.AddrIPv4.Port, err.Error())
+		unix.Close(s.Fd)
+		return TCPServer{}, fmt.Errorf("Failed to bind to Addr: %s\nReason: %s", SockaddrString(s.Addr), err.Error())
+	}
+	// The port chosen by the system if port is 0
+	if bound, err := unix.Getsockname(s.Fd); err == nil {
+		s.Addr = bound
 	}
 	return s, nil
 }
 
+// Connect opens a TCP connection to the given IPv4 or IPv6 address and port
+func Connect(ip IP, port int) (Conn, error) {
+	addr, family, err := sockaddr(ip, "", port)
+	if err != nil {
+		return Conn{}, fmt.Errorf("connect: %s", err.Error())
+	}
+	fd, err := unix.Socket(family, unix.SOCK_STREAM, unix.IPPROTO_IP)
+	if err != nil {
+		return Conn{}, fmt.Errorf("socket: %s", err.Error())
+	}
+	// * Connect will connect the socket to the address of the server
+	if err = unix.Connect(fd, addr); err != nil {
+		unix.Close(fd)
+		return Conn{}, err
+	}
+	return Conn{
+		Fd:   fd,
+		Addr: addr,
+	}, nil
+}
+
 // Accept accepts a connection on the TCPServer and return this connection
 func (s *TCPServer) Accept() (Conn, error) {
 	// * Accept extracts the first connection request on the queue of
 	// pending connections for the listening socket, sockfd, creates a new
 	// connected socket, and returns a new file descriptor referring
 	// to that socket and the address of this socket.
-	connFd, connAddr, err := unix.Accept(s.Fd)
+	connFd, connAddr, err := acceptCloexec(s.Fd, s.config.CloseOnExec)
 	if err != nil {
 		return Conn{}, err
 	}
+	if err = s.setConnOptions(connFd); err != nil {
+		unix.Close(connFd)
+		return Conn{}, err
+	}
 	return Conn{
 		Fd:   connFd,
 		Addr: connAddr,
@@ -82,5 +170,5 @@ func (s *TCPServer) Accept() (Conn, error) {
 
 // GetAddr returns a string formated containing the address and port
 func (s *TCPServer) GetAddr() string {
-	return fmt.Sprintf("%d:%d", s.AddrIPv4.Addr, s.AddrIPv4.Port)
+	return SockaddrString(s.Addr)
 }
@@ -0,0 +1,56 @@
+package net
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDialAddrDualStack(t *testing.T) {
+	s, err := DialAddr("::", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(s.Fd)
+	if err = s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := unix.Getsockname(s.Fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := sa.(*unix.SockaddrInet6).Port
+
+	tests := []struct {
+		ip          IP     // address connected
+		expected    string // expected peer address seen by the server
+		testContent string // test details
+	}{
+		{ParseIP("::1"), "[::1]", "IPv6 client"},
+		{ParseIP("127.0.0.1"), "[::ffff:127.0.0.1]", "IPv4 client"},
+	}
+	for _, tt := range tests {
+		c, err := Connect(tt.ip, port)
+		if err != nil {
+			t.Fatalf("Connect: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		}
+		conn, err := s.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := SockaddrString(conn.Addr); !strings.HasPrefix(actual, tt.expected+":") {
+			t.Errorf("Peer: expect %s, has %s - Test type: \033[31m%s\033[0m", tt.expected, actual, tt.testContent)
+		}
+		conn.Close()
+		c.Close()
+	}
+}
+
+func TestDialAddrInvalid(t *testing.T) {
+	for _, addr := range []string{"", "localhost", "1.2.3", "127.0.0.1%lo"} {
+		if _, err := DialAddr(addr, 0); err == nil {
+			t.Errorf("DialAddr(%q): expect an error", addr)
+		}
+	}
+}
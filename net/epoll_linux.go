@@ -0,0 +1,165 @@
+//go:build linux
+
+package net
+
+import (
+	"encoding/binary"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// epollTick is the maximum time waited for events, the idle connections
+// are closed at this interval or at half the idle timeout if shorter
+const epollTick = time.Second
+
+// EpollLoop is a Loop using the epoll readiness notifications of Linux.
+// The client sockets are registered once in edge-triggered mode: on an
+// event the socket is read or written until it would block.
+type EpollLoop struct {
+	*loopCore
+
+	epfd   int
+	wakeFd int // eventfd written by Post and Stop
+}
+
+// EpollSupported is true if NewEpollLoop is available on the platform
+const EpollSupported = true
+
+// NewEpollLoop returns a loop serving the connections accepted by the
+// listening socket s, the connections idle for longer than idleTimeout
+// are closed, 0 means no timeout
+func NewEpollLoop(s TCPServer, handler LoopHandler, idleTimeout time.Duration) (*EpollLoop, error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	wakeFd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, err
+	}
+	l := &EpollLoop{
+		loopCore: newLoopCore(s, handler, idleTimeout),
+		epfd:     epfd,
+		wakeFd:   wakeFd,
+	}
+	l.wake = l.wakeUp
+	l.unregister = l.remove
+	if err = unix.SetNonblock(s.Fd, true); err == nil {
+		// * The listening socket is level-triggered, the connections
+		// left in the queue are signaled again
+		err = l.add(s.Fd, unix.EPOLLIN)
+	}
+	if err == nil {
+		err = l.add(wakeFd, unix.EPOLLIN|unix.EPOLLET)
+	}
+	if err != nil {
+		l.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *EpollLoop) add(fd int, events uint32) error {
+	event := unix.EpollEvent{Events: events, Fd: int32(fd)}
+	return unix.EpollCtl(l.epfd, unix.EPOLL_CTL_ADD, fd, &event)
+}
+
+// remove stops the notifications of fd
+func (l *EpollLoop) remove(fd int) {
+	unix.EpollCtl(l.epfd, unix.EPOLL_CTL_DEL, fd, nil)
+}
+
+// wakeUp interrupts EpollWait
+func (l *EpollLoop) wakeUp() {
+	var one [8]byte
+	binary.LittleEndian.PutUint64(one[:], 1)
+	unix.Write(l.wakeFd, one[:])
+}
+
+func (l *EpollLoop) close() {
+	unix.Close(l.wakeFd)
+	unix.Close(l.epfd)
+}
+
+// accept accepts the pending connections until the queue is empty
+func (l *EpollLoop) accept() error {
+	for {
+		flags := unix.SOCK_NONBLOCK
+		if l.server.config.CloseOnExec {
+			flags |= unix.SOCK_CLOEXEC
+		}
+		fd, addr, err := unix.Accept4(l.server.Fd, flags)
+		if err != nil {
+			return acceptError(err)
+		}
+		if err = l.server.setConnOptions(fd); err != nil {
+			unix.Close(fd)
+			continue
+		}
+		// * Edge-triggered: an event is received when new data arrives
+		// or when the socket becomes writable again
+		err = l.add(fd, unix.EPOLLIN|unix.EPOLLOUT|unix.EPOLLRDHUP|unix.EPOLLET)
+		if err != nil {
+			unix.Close(fd)
+			return err
+		}
+		l.open(fd, addr)
+	}
+}
+
+// Run accepts and serves the connections until Stop is called
+func (l *EpollLoop) Run() error {
+	defer l.close()
+	defer l.shutdown()
+
+	tick := epollTick
+	if l.idleTimeout > 0 && l.idleTimeout/2 < tick {
+		tick = l.idleTimeout / 2
+	}
+	events := make([]unix.EpollEvent, 256)
+	lastSweep := time.Now()
+	for !l.isStopped() {
+		n, err := unix.EpollWait(l.epfd, events, int(tick/time.Millisecond))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, event := range events[:n] {
+			fd := int(event.Fd)
+			switch fd {
+			case l.server.Fd:
+				if err := l.accept(); err != nil {
+					return err
+				}
+				continue
+			case l.wakeFd:
+				var buf [8]byte
+				unix.Read(l.wakeFd, buf[:])
+				l.runPosted()
+				continue
+			}
+			c, ok := l.conns[fd]
+			if !ok {
+				continue
+			}
+			if event.Events&(unix.EPOLLIN|unix.EPOLLRDHUP|unix.EPOLLHUP|unix.EPOLLERR) != 0 {
+				l.readable(c)
+			}
+			if event.Events&unix.EPOLLOUT != 0 {
+				l.writable(c)
+			}
+		}
+		if now := time.Now(); now.Sub(lastSweep) >= tick {
+			l.sweep(now)
+			lastSweep = now
+		}
+		if l.drained() {
+			return nil
+		}
+	}
+	return nil
+}
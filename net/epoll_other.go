@@ -0,0 +1,29 @@
+//go:build !linux
+
+package net
+
+import (
+	"errors"
+	"time"
+)
+
+// EpollSupported is true if NewEpollLoop is available on the platform
+const EpollSupported = false
+
+// errEpollUnsupported is returned by NewEpollLoop out of Linux
+var errEpollUnsupported = errors.New("net: epoll is only available on linux")
+
+// EpollLoop is only available on Linux
+type EpollLoop struct {
+	*loopCore
+}
+
+// NewEpollLoop returns an error, epoll is only available on Linux
+func NewEpollLoop(s TCPServer, handler LoopHandler, idleTimeout time.Duration) (*EpollLoop, error) {
+	return nil, errEpollUnsupported
+}
+
+// Run returns an error, epoll is only available on Linux
+func (l *EpollLoop) Run() error {
+	return errEpollUnsupported
+}
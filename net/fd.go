@@ -1,29 +1,37 @@
 package net
 
-import "golang.org/x/sys/unix"
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
 
 // type FdSet struct {
-//     Bits [32]int32 // FD_SETSIZE = 1024 = 32x32
+//     Bits [32]int32 // FD_SETSIZE = 1024 = 32x32 on darwin
+//     Bits [16]int64 // FD_SETSIZE = 1024 = 16x64 on linux/amd64
 // }
 
+// fdBits is the number of fds stored in an element of FdSet.Bits
+const fdBits = int(unsafe.Sizeof(unix.FdSet{}.Bits[0]) * 8)
+
 // FDZero set to zero the fdSet
 func FDZero(p *unix.FdSet) {
-	p.Bits = [32]int32{}
+	*p = unix.FdSet{}
 }
 
 // FDSet actives a given bit of fdSet
 func FDSet(fd int, p *unix.FdSet) {
-	p.Bits[fd/32] |= (1 << (uint(fd) % 32))
+	p.Bits[fd/fdBits] |= (1 << (uint(fd) % uint(fdBits)))
 }
 
 // FDClr actives a given bit of fdSet
 func FDClr(fd int, p *unix.FdSet) {
-	p.Bits[fd/32] &^= (1 << (uint(fd) % 32))
+	p.Bits[fd/fdBits] &^= (1 << (uint(fd) % uint(fdBits)))
 }
 
 // FDIsSet return true if the given fd is set
 func FDIsSet(fd int, p *unix.FdSet) bool {
-	return p.Bits[fd/32]&(1<<(uint(fd)%32)) != 0
+	return p.Bits[fd/fdBits]&(1<<(uint(fd)%uint(fdBits))) != 0
 }
 
 // FDAddr is the type storing the sockaddr of each fd
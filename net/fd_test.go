@@ -1,12 +1,25 @@
 package net
 
 import (
+	"encoding/binary"
 	"fmt"
 	"testing"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
+// words32 returns the fd set as 32 bits words whatever the size of the
+// elements of FdSet.Bits on the platform
+func words32(p *unix.FdSet) [32]int32 {
+	var words [32]int32
+	b := (*[unsafe.Sizeof(*p)]byte)(unsafe.Pointer(p))
+	for i := range words {
+		words[i] = int32(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return words
+}
+
 func checkDiff(actual, expected [32]int32) string {
 	strActual := fmt.Sprintf("%x", actual)
 	strExpected := fmt.Sprintf("%x", expected)
@@ -23,15 +36,15 @@ func TestFD(t *testing.T) {
 	expected := [32]int32{
 		int32(0x8), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0),
 	}
-	if err := checkDiff(activeFdSet.Bits, expected); err != "" {
-		t.Errorf(err)
+	if err := checkDiff(words32(&activeFdSet), expected); err != "" {
+		t.Error(err)
 	}
 	FDSet(72, &activeFdSet)
 	expected = [32]int32{
 		int32(0x8), int32(0), int32(0x100), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0),
 	}
-	if err := checkDiff(activeFdSet.Bits, expected); err != "" {
-		t.Errorf(err)
+	if err := checkDiff(words32(&activeFdSet), expected); err != "" {
+		t.Error(err)
 	}
 	actualBool := FDIsSet(72, &activeFdSet)
 	if actualBool == false {
@@ -49,14 +62,14 @@ func TestFD(t *testing.T) {
 	expected = [32]int32{
 		int32(0x8), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0),
 	}
-	if err := checkDiff(activeFdSet.Bits, expected); err != "" {
-		t.Errorf(err)
+	if err := checkDiff(words32(&activeFdSet), expected); err != "" {
+		t.Error(err)
 	}
 	FDClr(255, &activeFdSet)
 	expected = [32]int32{
 		int32(0x8), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0), int32(0),
 	}
-	if err := checkDiff(activeFdSet.Bits, expected); err != "" {
-		t.Errorf(err)
+	if err := checkDiff(words32(&activeFdSet), expected); err != "" {
+		t.Error(err)
 	}
 }
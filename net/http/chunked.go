@@ -0,0 +1,113 @@
+package http
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Hypertext Transfer Protocol (HTTP/1.1): Chunked Transfer Coding
+// https://tools.ietf.org/html/rfc7230#section-4.1
+
+const maxChunkLineBytes = 4096
+
+var (
+	errMalformedChunk      = statusError{StatusBadRequest, "Malformed chunked encoding"}
+	errUnsupportedEncoding = statusError{StatusNotImplemented, "Unsupported transfer coding"}
+)
+
+// parseChunkSize returns the size of a chunk from its size line, the chunk
+// extensions are ignored
+// chunk-size [ chunk-ext ] CRLF
+func parseChunkSize(line string) (int64, error) {
+	if ext := strings.IndexByte(line, ';'); ext != -1 {
+		line = line[:ext]
+	}
+	line = strings.TrimRight(line, " \t")
+	if line == "" || len(line) > 16 {
+		return 0, errMalformedChunk
+	}
+	var size int64
+	for i := 0; i < len(line); i++ {
+		b := line[i]
+		switch {
+		case '0' <= b && b <= '9':
+			b = b - '0'
+		case 'a' <= b && b <= 'f':
+			b = b - 'a' + 10
+		case 'A' <= b && b <= 'F':
+			b = b - 'A' + 10
+		default:
+			return 0, errMalformedChunk
+		}
+		size = size<<4 | int64(b)
+	}
+	// 16 hex digits can overflow int64
+	if size < 0 {
+		return 0, errMalformedChunk
+	}
+	return size, nil
+}
+
+// readChunked reads a body sent with the chunked transfer coding and
+// returns the reassembled data and the trailer fields
+// chunked-body = *chunk last-chunk trailer-part CRLF
+func (cr *connReader) readChunked(maxBody int64, maxTrailer int) ([]byte, Header, error) {
+	var body []byte
+	for {
+		line, err := cr.readLine(maxChunkLineBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := parseChunkSize(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		if size == 0 {
+			break
+		}
+		if int64(len(body))+size > maxBody {
+			return nil, nil, errBodyTooLarge
+		}
+		data, err := cr.readFull(size + 2)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return nil, nil, errMalformedChunk
+		}
+		body = append(body, data[:size]...)
+	}
+	trailer, err := cr.readTrailer(maxTrailer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, trailer, nil
+}
+
+// readTrailer reads the header fields sent after the last chunk until the
+// final empty line
+// trailer-part = *( header-field CRLF )
+func (cr *connReader) readTrailer(max int) (Header, error) {
+	var trailer Header
+	var size int
+	for {
+		line, err := cr.readLine(maxChunkLineBytes)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			return trailer, nil
+		}
+		if size += len(line); size > max {
+			return nil, errHeaderTooLarge
+		}
+		key, value, ok := parseHeaderField(line)
+		if !ok {
+			return nil, errMalformedChunk
+		}
+		if trailer == nil {
+			trailer = Header{}
+		}
+		trailer.AddHeader(key, value)
+	}
+}
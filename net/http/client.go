@@ -1,29 +1,47 @@
 package http
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
-	"net"
-	"regexp"
+	"strconv"
+	"strings"
 
-	"golang.org/x/sys/unix"
+	"../../net"
+	"github.com/kylelemons/godebug/pretty"
 )
 
-func NewRequest(method, url string, body []byte) (Request, error) {
+// NewRequest returns a request to send to rawurl, the "http://" scheme
+// is used if rawurl has none
+func NewRequest(method, rawurl string, body []byte) (Request, error) {
 	if method == "" {
 		method = "GET"
 	}
 	if !validMethod(method) {
 		return Request{}, errors.New("Invalid method")
 	}
-	host := regexp.MustCompile(`^(?:https?:\/\/)?(?:[^@\/\n]+@)?(?:www\.)?([^:\/\n]+)`).Find([]byte(url))
+	if !strings.Contains(rawurl, "://") {
+		rawurl = "http://" + rawurl
+	}
+	u, err := ParseURL(rawurl)
+	if err != nil {
+		return Request{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Request{}, errors.New("Unsupported scheme " + u.Scheme)
+	}
+	if u.Host == "" {
+		return Request{}, errors.New("Missing host in " + rawurl)
+	}
 	request := Request{
-		Method: method,
-		Host:   string(host),
-		URL:    url[len(host):],
+		Method:     method,
+		Host:       u.HostPort(),
+		URL:        u,
+		RequestURI: u.RequestURI(),
 
-		Proto: "HTTP/1.1",
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
 
 		Header: Header{},
 
@@ -33,64 +51,205 @@ func NewRequest(method, url string, body []byte) (Request, error) {
 	return request, nil
 }
 
-func Do(req *Request) (Request, error) {
-	serverFD, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, unix.IPPROTO_IP)
-	if err != nil {
-		log.Fatal("Socket: ", err)
+// maxResponseBodyBytes is the maximum size of a response body read by Do
+const maxResponseBodyBytes = 100 << 20 // 100 MB
+
+var errBadStatusLine = errors.New("Invalid response status line")
+
+// Response is the structure where the data of a response received by
+// the client is stored
+type Response struct {
+	Status     string // "200 OK"
+	StatusCode int    // 200
+	Reason     string // "OK"
+
+	Proto      string // "HTTP/1.1"
+	ProtoMajor int    // 1
+	ProtoMinor int    // 1
+
+	Header Header
+
+	Body []byte
+
+	// Trailer stores the headers sent after a chunked body
+	Trailer Header
+
+	// ContentLength is the length of the body received
+	ContentLength int64
+
+	// Close is true if the connection cannot be used after the response
+	Close bool
+
+	// Request is the request sent to obtain the response
+	Request *Request
+
+	// Redirects stores the redirect responses followed to obtain the
+	// response, the oldest first
+	Redirects []*Response
+
+	// TLS describes the TLS connection the response was received on: the
+	// negotiated protocol and the certificates of the server, nil for a
+	// cleartext connection
+	TLS *tls.ConnectionState
+}
+
+// Print print the response structure
+func (resp *Response) Print() {
+	pretty.Print(resp)
+}
+
+// parseStatusLine stores the version, the status code and the reason
+// of the response
+// status-line = HTTP-version SP status-code SP reason-phrase
+func (resp *Response) parseStatusLine(line string) error {
+	status := strings.SplitN(line, " ", 3)
+	if len(status) < 2 {
+		return errBadStatusLine
 	}
-	// Resolve IP Address DNS - Original
-	hostIP, err := net.LookupIP(req.Host)
-	if err != nil {
-		fmt.Println(err)
-		return Request{}, err
+	var ok bool
+	resp.ProtoMajor, resp.ProtoMinor, ok = parseHTTPVersion(status[0])
+	if !ok {
+		return errBadStatusLine
 	}
-	var addr net.IP
-	for _, ip := range hostIP {
-		if addr = ip.To4(); addr != nil {
-			break
-		}
+	resp.Proto = status[0]
+	if len(status[1]) != 3 {
+		return errBadStatusLine
+	}
+	code, err := strconv.Atoi(status[1])
+	if err != nil || code < 100 {
+		return errBadStatusLine
+	}
+	resp.StatusCode = code
+	if len(status) == 3 {
+		resp.Reason = status[2]
+	}
+	resp.Status = strings.TrimSpace(status[1] + " " + resp.Reason)
+	return nil
+}
+
+// bodyAllowed returns false if the response cannot have a body
+// - RFC 7230, 3.3.3
+func (resp *Response) bodyAllowed() bool {
+	if resp.Request != nil && resp.Request.Method == "HEAD" {
+		return false
 	}
-	serverAddr := &unix.SockaddrInet4{
-		Port: 8085,
-		Addr: [4]byte{addr[0], addr[1], addr[2], addr[3]},
+	return bodyAllowed(resp.StatusCode)
+}
+
+// keepAlive returns true if the server keeps the connection open after
+// the response, see Request.keepAlive
+func (resp *Response) keepAlive() bool {
+	if resp.Header.HasToken(Connection, "close") {
+		return false
 	}
+	if resp.ProtoMajor > 1 || (resp.ProtoMajor == 1 && resp.ProtoMinor >= 1) {
+		return true
+	}
+	return resp.Header.HasToken(Connection, "keep-alive")
+}
 
-	fmt.Println("a")
-	err = unix.Connect(serverFD, serverAddr)
+// readResponse reads and parses the response received to req
+// io.EOF is returned if the connection is closed before any data.
+func readResponse(cr *connReader, req *Request) (*Response, error) {
+	header, err := cr.readHeader(DefaultMaxHeaderBytes)
 	if err != nil {
-		if err == unix.ECONNREFUSED {
-			fmt.Println("* Connection failed")
-		} else {
-			fmt.Println("Connect:", err)
+		return nil, err
+	}
+	lines := strings.Split(header, "\r\n")
+	resp := &Response{Header: Header{}, Request: req}
+	if err := resp.parseStatusLine(lines[0]); err != nil {
+		return nil, err
+	}
+	for _, line := range lines[1:] {
+		key, value, ok := parseHeaderField(line)
+		if !ok {
+			return nil, errors.New("Invalid response header " + strconv.Quote(line))
 		}
-		unix.Close(serverFD)
-		return Request{}, err
+		resp.Header.AddHeader(key, value)
 	}
-	fmt.Println("r")
-	err = unix.Sendmsg(
-		serverFD,
-		req.Bytes(),
-		nil, serverAddr, unix.MSG_DONTWAIT)
+
+	resp.Close = !resp.keepAlive()
+	if !resp.bodyAllowed() {
+		return resp, nil
+	}
+	resp.Body, err = resp.readBody(cr)
 	if err != nil {
-		fmt.Println("Sendmsg: ", err)
-		return Request{}, err
+		return nil, err
+	}
+	resp.ContentLength = int64(len(resp.Body))
+	return resp, nil
+}
+
+// readBody reads the body of the response, its length is given by the
+// Transfer-Encoding header if any, else by the Content-Length header,
+// else the body ends with the connection
+func (resp *Response) readBody(cr *connReader) ([]byte, error) {
+	if codings := resp.Header.List(TransferEncoding); len(codings) != 0 {
+		if !strings.EqualFold(codings[len(codings)-1], "chunked") {
+			resp.Close = true
+			return cr.readAll(maxResponseBodyBytes)
+		}
+		body, trailer, err := cr.readChunked(maxResponseBodyBytes, DefaultMaxHeaderBytes)
+		if err != nil {
+			return nil, err
+		}
+		resp.Trailer = trailer
+		return body, nil
 	}
+	if values := resp.Header.Values(ContentLength); len(values) != 0 {
+		length, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil || length < 0 {
+			return nil, errors.New("Invalid response Content-Length " + strconv.Quote(values[0]))
+		}
+		for _, value := range values[1:] {
+			if value != values[0] {
+				return nil, errors.New("Conflicting response Content-Length")
+			}
+		}
+		if length > maxResponseBodyBytes {
+			return nil, errBodyTooLarge
+		}
+		return cr.readFull(length)
+	}
+	resp.Close = true
+	return cr.readAll(maxResponseBodyBytes)
+}
+
+// defaultPort returns the port used for the scheme of u when the URL has
+// none
+func defaultPort(u *URL) string {
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
 
-	buf := make([]byte, 8000)
-	fmt.Println("y")
-	_, _, err = unix.Recvfrom(serverFD, buf, 0)
+// dial opens a connection to the host and the port of the URL, each
+// address of the host is tried until one accepts the connection
+func dial(u *URL) (net.Conn, error) {
+	port, _ := strconv.Atoi(defaultPort(u))
+	if u.Port != "" {
+		p, err := strconv.Atoi(u.Port)
+		if err != nil || p <= 0 || p > 0xFFFF {
+			return net.Conn{}, errors.New("Invalid port " + u.Port)
+		}
+		port = p
+	}
+	ips, err := net.LookupIP(u.Host)
 	if err != nil {
-		fmt.Println("Recvfrom: ", err)
-		unix.Close(serverFD)
-		return Request{}, err
+		return net.Conn{}, err
 	}
-	fmt.Println("é", string(buf), "|")
-	unix.Close(serverFD)
-	resp := InitRequest()
-	// err = resp.RequestParse(string(buf))
-	// if err != nil {
-	// 	fmt.Println("RequestParse: ", err)
-	// 	return Request{}, err
-	// }
-	return *resp, nil
+	for _, ip := range ips {
+		var c net.Conn
+		c, err = net.Connect(ip, port)
+		if err == nil {
+			return c, nil
+		}
+	}
+	return net.Conn{}, fmt.Errorf("Failed to connect to %s: %s", u.HostPort(), err.Error())
+}
+
+// Do sends the request with DefaultClient and returns the response received
+func Do(req *Request) (*Response, error) {
+	return DefaultClient.Do(req)
 }
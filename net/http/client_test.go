@@ -0,0 +1,99 @@
+package http
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var readResponseTests = []struct {
+	raw         string // input
+	method      string // method of the request
+	status      int    // expected status code
+	reason      string // expected reason
+	body        string // expected body
+	err         bool   // error expected
+	testContent string // test details
+}{
+	{
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+		"GET", 200, "OK", "hello", false, "Content-Length",
+	},
+	{
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n",
+		"GET", 200, "OK", "hello world", false, "Chunked body",
+	},
+	{
+		"HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the end",
+		"GET", 200, "OK", "until the end", false, "Body ended by the connection close",
+	},
+	{
+		"HTTP/1.1 404 Not Found\r\nContent-Length: 3\r\n\r\n",
+		"HEAD", 404, "Not Found", "", false, "No body to HEAD request",
+	},
+	{
+		"HTTP/1.1 204 No Content\r\n\r\n",
+		"DELETE", 204, "No Content", "", false, "No body with 204",
+	},
+	{
+		"HTTP/1.1 299\r\nContent-Length: 0\r\n\r\n",
+		"GET", 299, "", "", false, "Status without reason",
+	},
+	{
+		"HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort",
+		"GET", 0, "", "", true, "Truncated body",
+	},
+	{
+		"HTTP/1.1 20 OK\r\n\r\n",
+		"GET", 0, "", "", true, "Invalid status code",
+	},
+	{
+		"ICY 200 OK\r\n\r\n",
+		"GET", 0, "", "", true, "Invalid version",
+	},
+	{
+		"HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Length: 3\r\n\r\nabc",
+		"GET", 0, "", "", true, "Conflicting Content-Length",
+	},
+}
+
+func TestReadResponse(t *testing.T) {
+	for _, tt := range readResponseTests {
+		req := &Request{Method: tt.method}
+		cr := newConnReader(iotest.OneByteReader(strings.NewReader(tt.raw)))
+		resp, err := readResponse(cr, req)
+		if (err != nil) != tt.err {
+			t.Errorf("readResponse: expect error %v, has %v - Test type: \033[31m%s\033[0m", tt.err, err, tt.testContent)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != tt.status || resp.Reason != tt.reason {
+			t.Errorf("Status: expect %d %q, has %d %q - Test type: \033[31m%s\033[0m", tt.status, tt.reason, resp.StatusCode, resp.Reason, tt.testContent)
+		}
+		if string(resp.Body) != tt.body {
+			t.Errorf("Body: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.body, string(resp.Body), tt.testContent)
+		}
+		if resp.Request != req {
+			t.Errorf("Request: expect the request sent - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+	}
+}
+
+func TestReadResponseInterim(t *testing.T) {
+	raw := "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok"
+	cr := newConnReader(strings.NewReader(raw))
+	interim, err := readResponse(cr, &Request{Method: "POST"})
+	if err != nil || interim.StatusCode != StatusContinue {
+		t.Fatalf("readResponse: expect 100, has %v %v", interim, err)
+	}
+	final, err := readResponse(cr, &Request{Method: "POST"})
+	if err != nil || final.StatusCode != StatusCreated || string(final.Body) != "ok" {
+		t.Errorf("readResponse: expect 201 \"ok\", has %v %v", final, err)
+	}
+	if _, err := readResponse(cr, nil); err != io.EOF {
+		t.Errorf("readResponse: expect %v, has %v", io.EOF, err)
+	}
+}
@@ -0,0 +1,317 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP State Management Mechanism
+// https://tools.ietf.org/html/rfc6265
+
+// TimeFormat is the format of the dates sent in the headers like Expires
+// - RFC 7231, 7.1.1.1
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// ErrNoCookie is returned by Request.Cookie when the cookie is not found
+var ErrNoCookie = errors.New("http: named cookie not present")
+
+// SameSite is the value of the SameSite attribute of a cookie
+type SameSite int
+
+const (
+	SameSiteDefaultMode SameSite = iota // attribute not sent
+	SameSiteLaxMode
+	SameSiteStrictMode
+	SameSiteNoneMode
+)
+
+// Cookie is a cookie sent by a server in a Set-Cookie header or by a
+// client in a Cookie header, the attributes are only used by Set-Cookie
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is the lifetime of the cookie in seconds, 0 means no Max-Age
+	// attribute, a negative value deletes the cookie now ("Max-Age=0")
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite SameSite
+}
+
+// isTokenByte returns true for the characters allowed in a token, the
+// tchar of RFC 7230, 3.2.6
+func isTokenByte(c byte) bool {
+	if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieValueByte returns true for the characters allowed in a cookie
+// value, the space and the comma are accepted and quoted when sent
+// cookie-octet = %x21 / %x23-2B / %x2D-3A / %x3C-5B / %x5D-7E
+func isCookieValueByte(c byte) bool {
+	return 0x20 <= c && c < 0x7f && c != '"' && c != ';' && c != '\\'
+}
+
+// sanitize removes the characters of s refused by valid
+func sanitize(s string, valid func(byte) bool) string {
+	for i := 0; i < len(s); i++ {
+		if !valid(s[i]) {
+			var buf strings.Builder
+			for j := 0; j < len(s); j++ {
+				if valid(s[j]) {
+					buf.WriteByte(s[j])
+				}
+			}
+			return buf.String()
+		}
+	}
+	return s
+}
+
+func sanitizeCookieValue(v string) string {
+	v = sanitize(v, isCookieValueByte)
+	if strings.ContainsAny(v, " ,") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// isPathByte returns true for the characters allowed in the Path attribute
+// path-value = *<any CHAR except CTLs or ";">
+func isPathByte(c byte) bool {
+	return 0x20 <= c && c < 0x7f && c != ';'
+}
+
+// parseCookieValue removes the quotes around a cookie value, ok is false
+// if the value contains invalid characters
+func parseCookieValue(raw string) (string, bool) {
+	if len(raw) > 1 && raw[0] == '"' && raw[len(raw)-1] == '"' {
+		raw = raw[1 : len(raw)-1]
+	}
+	for i := 0; i < len(raw); i++ {
+		if !isCookieValueByte(raw[i]) {
+			return "", false
+		}
+	}
+	return raw, true
+}
+
+// String returns the cookie as sent in a Set-Cookie header, or in a
+// Cookie header if only the name and the value are set.
+// "" is returned if the name is invalid.
+func (c *Cookie) String() string {
+	if c == nil || !isToken(c.Name) {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteString(c.Name + "=" + sanitizeCookieValue(c.Value))
+	if c.Path != "" {
+		buf.WriteString("; Path=" + sanitize(c.Path, isPathByte))
+	}
+	if domain := strings.TrimPrefix(c.Domain, "."); domain != "" && isToken(domain) {
+		buf.WriteString("; Domain=" + domain)
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() >= 1601 {
+		buf.WriteString("; Expires=" + c.Expires.UTC().Format(TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		buf.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		buf.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		buf.WriteString("; HttpOnly")
+	}
+	if c.Secure {
+		buf.WriteString("; Secure")
+	}
+	switch c.SameSite {
+	case SameSiteLaxMode:
+		buf.WriteString("; SameSite=Lax")
+	case SameSiteStrictMode:
+		buf.WriteString("; SameSite=Strict")
+	case SameSiteNoneMode:
+		buf.WriteString("; SameSite=None")
+	}
+	return buf.String()
+}
+
+// cookieDateFormats are the formats of the Expires attribute accepted,
+// the first one is the only one sent
+var cookieDateFormats = []string{
+	TimeFormat,
+	"Mon, 02-Jan-2006 15:04:05 MST",
+	"Monday, 02-Jan-06 15:04:05 MST", // RFC 850
+	"Mon Jan _2 15:04:05 2006",       // ANSI C asctime
+	"Mon, 02 Jan 06 15:04:05 MST",
+}
+
+func parseCookieDate(value string) (time.Time, bool) {
+	for _, format := range cookieDateFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// readSetCookie parses the value of a Set-Cookie header, the invalid
+// attributes are ignored - RFC 6265, 5.2
+func readSetCookie(line string) (*Cookie, bool) {
+	parts := strings.Split(line, ";")
+	nameValue := strings.SplitN(parts[0], "=", 2)
+	if len(nameValue) != 2 {
+		return nil, false
+	}
+	name := strings.TrimSpace(nameValue[0])
+	if !isToken(name) {
+		return nil, false
+	}
+	value, ok := parseCookieValue(strings.TrimSpace(nameValue[1]))
+	if !ok {
+		return nil, false
+	}
+	c := &Cookie{Name: name, Value: value}
+
+	for _, attr := range parts[1:] {
+		keyValue := strings.SplitN(attr, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(keyValue[0]))
+		var value string
+		if len(keyValue) == 2 {
+			value = strings.TrimSpace(keyValue[1])
+		}
+		switch key {
+		case "expires":
+			if t, ok := parseCookieDate(value); ok {
+				c.Expires = t
+			}
+		case "max-age":
+			seconds, err := strconv.Atoi(value)
+			if err != nil || (value[0] != '-' && (value[0] < '0' || value[0] > '9')) {
+				continue
+			}
+			if seconds <= 0 {
+				seconds = -1
+			}
+			c.MaxAge = seconds
+		case "domain":
+			c.Domain = strings.ToLower(strings.TrimPrefix(value, "."))
+		case "path":
+			if strings.HasPrefix(value, "/") {
+				c.Path = value
+			}
+		case "secure":
+			c.Secure = true
+		case "httponly":
+			c.HttpOnly = true
+		case "samesite":
+			switch strings.ToLower(value) {
+			case "lax":
+				c.SameSite = SameSiteLaxMode
+			case "strict":
+				c.SameSite = SameSiteStrictMode
+			case "none":
+				c.SameSite = SameSiteNoneMode
+			}
+		}
+	}
+	return c, true
+}
+
+// readCookies parses the values of the Cookie headers, only the cookies
+// named name are returned if name is not ""
+// cookie-string = cookie-pair *( ";" SP cookie-pair ) - RFC 6265, 4.2.1
+func readCookies(h Header, name string) []*Cookie {
+	var cookies []*Cookie
+	for _, line := range h.Values(CookieHeader) {
+		for _, pair := range strings.Split(line, ";") {
+			nameValue := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(nameValue) != 2 || !isToken(nameValue[0]) {
+				continue
+			}
+			if name != "" && nameValue[0] != name {
+				continue
+			}
+			value, ok := parseCookieValue(nameValue[1])
+			if !ok {
+				continue
+			}
+			cookies = append(cookies, &Cookie{Name: nameValue[0], Value: value})
+		}
+	}
+	return cookies
+}
+
+// Cookies returns the cookies sent with the request
+func (r *Request) Cookies() []*Cookie {
+	return readCookies(r.Header, "")
+}
+
+// Cookie returns the cookie named name sent with the request,
+// ErrNoCookie if there is none
+func (r *Request) Cookie(name string) (*Cookie, error) {
+	if name == "" {
+		return nil, ErrNoCookie
+	}
+	if cookies := readCookies(r.Header, name); len(cookies) != 0 {
+		return cookies[0], nil
+	}
+	return nil, ErrNoCookie
+}
+
+// AddCookie adds a cookie to the Cookie header of the request, only the
+// name and the value are sent
+func (r *Request) AddCookie(c *Cookie) {
+	pair := (&Cookie{Name: c.Name, Value: c.Value}).String()
+	if pair == "" {
+		return
+	}
+	if r.Header == nil {
+		r.Header = Header{}
+	}
+	if values := r.Header.Values(CookieHeader); len(values) != 0 {
+		values[len(values)-1] += "; " + pair
+		return
+	}
+	r.Header.Set(CookieHeader, pair)
+}
+
+// Cookies returns the valid cookies of the Set-Cookie headers of the
+// response
+func (resp *Response) Cookies() []*Cookie {
+	var cookies []*Cookie
+	for _, line := range resp.Header.Values(SetCookieHeader) {
+		if c, ok := readSetCookie(line); ok {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies
+}
+
+// SetCookie adds a Set-Cookie header to the response, an invalid cookie
+// is ignored
+func SetCookie(w ResponseWriter, c *Cookie) {
+	if value := c.String(); value != "" {
+		w.Header().Add(SetCookieHeader, value)
+	}
+}
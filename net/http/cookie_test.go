@@ -0,0 +1,177 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var cookieStringTests = []struct {
+	cookie      *Cookie // input
+	expected    string  // expected Set-Cookie value
+	testContent string  // test details
+}{
+	{&Cookie{Name: "id", Value: "42"}, "id=42", "Name and value"},
+	{
+		&Cookie{Name: "session", Value: "abc", Path: "/", Domain: ".example.com", MaxAge: 3600, HttpOnly: true, Secure: true, SameSite: SameSiteLaxMode},
+		"session=abc; Path=/; Domain=example.com; Max-Age=3600; HttpOnly; Secure; SameSite=Lax", "Attributes",
+	},
+	{
+		&Cookie{Name: "old", Value: "", Expires: time.Date(2019, 10, 21, 7, 28, 0, 0, time.UTC), MaxAge: -1},
+		"old=; Expires=Mon, 21 Oct 2019 07:28:00 GMT; Max-Age=0", "Deletion",
+	},
+	{&Cookie{Name: "text", Value: "a b;c\"d"}, `text="a bcd"`, "Value sanitized and quoted"},
+	{&Cookie{Name: "bad name", Value: "x"}, "", "Invalid name"},
+}
+
+func TestCookieString(t *testing.T) {
+	for _, tt := range cookieStringTests {
+		if actual := tt.cookie.String(); actual != tt.expected {
+			t.Errorf("String: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.expected, actual, tt.testContent)
+		}
+	}
+}
+
+var readSetCookieTests = []struct {
+	line        string  // input
+	expected    *Cookie // expected result, nil if invalid
+	testContent string  // test details
+}{
+	{"id=42", &Cookie{Name: "id", Value: "42"}, "Name and value"},
+	{
+		"session=\"abc\"; path=/app; DOMAIN=.Example.com; Max-Age=60; secure; HttpOnly; SameSite=Strict",
+		&Cookie{Name: "session", Value: "abc", Path: "/app", Domain: "example.com", MaxAge: 60, Secure: true, HttpOnly: true, SameSite: SameSiteStrictMode},
+		"Attributes case-insensitive",
+	},
+	{
+		"old=x; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=0",
+		&Cookie{Name: "old", Value: "x", Expires: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), MaxAge: -1},
+		"Expires and Max-Age=0",
+	},
+	{
+		"a=b; Expires=Wednesday, 21-Oct-15 07:28:00 GMT; Path=relative; Max-Age=soon",
+		&Cookie{Name: "a", Value: "b", Expires: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)},
+		"RFC 850 date, invalid attributes ignored",
+	},
+	{"novalue", nil, "Missing '='"},
+	{"=value", nil, "Empty name"},
+}
+
+func TestReadSetCookie(t *testing.T) {
+	for _, tt := range readSetCookieTests {
+		actual, ok := readSetCookie(tt.line)
+		if tt.expected == nil {
+			if ok {
+				t.Errorf("readSetCookie(%q): expect invalid, has %v - Test type: \033[31m%s\033[0m", tt.line, actual, tt.testContent)
+			}
+			continue
+		}
+		if diff := pretty.Compare(actual, tt.expected); diff != "" {
+			t.Errorf("readSetCookie(%q): diff (-has +expect)\n%s - Test type: \033[31m%s\033[0m", tt.line, diff, tt.testContent)
+		}
+	}
+}
+
+func TestRequestCookies(t *testing.T) {
+	r := InitRequest()
+	r.RequestParse("GET / HTTP/1.1\r\nCookie: id=42; theme=\"dark\"; bad name=x\r\n\r\n")
+	expected := []*Cookie{{Name: "id", Value: "42"}, {Name: "theme", Value: "dark"}}
+	if diff := pretty.Compare(r.Cookies(), expected); diff != "" {
+		t.Errorf("Cookies: diff (-has +expect)\n%s", diff)
+	}
+	if c, err := r.Cookie("theme"); err != nil || c.Value != "dark" {
+		t.Errorf("Cookie: expect dark, has %v %v", c, err)
+	}
+	if _, err := r.Cookie("missing"); err != ErrNoCookie {
+		t.Errorf("Cookie: expect %v, has %v", ErrNoCookie, err)
+	}
+	r.AddCookie(&Cookie{Name: "lang", Value: "fr", Path: "/ignored"})
+	if actual := r.Header.Get(CookieHeader); actual != "id=42; theme=\"dark\"; bad name=x; lang=fr" {
+		t.Errorf("AddCookie: unexpected Cookie header %q", actual)
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	jar := NewCookieJar()
+	u, _ := ParseURL("http://www.example.com/shop/cart")
+	jar.SetCookies(u, []*Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: "example.com", Path: "/"},
+		{Name: "secure", Value: "3", Path: "/", Secure: true},
+		{Name: "root", Value: "4", Path: "/"},
+		{Name: "public", Value: "5", Domain: "com"},
+		{Name: "other", Value: "6", Domain: "other.com"},
+	})
+
+	tests := []struct {
+		url         string // requested url
+		expected    string // expected Cookie header
+		testContent string // test details
+	}{
+		{"http://www.example.com/shop/item", "host=1; domain=2; root=4", "Default path, longest path first"},
+		{"http://www.example.com/", "domain=2; root=4", "Path not matching"},
+		{"https://www.example.com/", "domain=2; secure=3; root=4", "Secure cookie over https"},
+		{"http://api.example.com/shop", "domain=2", "Subdomain"},
+		{"http://example.org/", "", "Other domain"},
+	}
+	for _, tt := range tests {
+		u, _ := ParseURL(tt.url)
+		r := InitRequest()
+		for _, c := range jar.Cookies(u) {
+			r.AddCookie(c)
+		}
+		if actual := r.Header.Get(CookieHeader); actual != tt.expected {
+			t.Errorf("Cookies(%s): expect %q, has %q - Test type: \033[31m%s\033[0m", tt.url, tt.expected, actual, tt.testContent)
+		}
+	}
+
+	jar.SetCookies(u, []*Cookie{{Name: "root", Path: "/", MaxAge: -1}, {Name: "host", Value: "7"}})
+	u, _ = ParseURL("http://www.example.com/shop/")
+	r := InitRequest()
+	for _, c := range jar.Cookies(u) {
+		r.AddCookie(c)
+	}
+	if actual := r.Header.Get(CookieHeader); actual != "host=7; domain=2" {
+		t.Errorf("Cookies: expect deleted and replaced cookies, has %q", actual)
+	}
+}
+
+func TestCookieJarZeroValue(t *testing.T) {
+	jar := &CookieJar{}
+	u, _ := ParseURL("http://www.example.com/")
+	if cookies := jar.Cookies(u); len(cookies) != 0 {
+		t.Errorf("Cookies: expect none, has %d", len(cookies))
+	}
+	jar.SetCookies(u, []*Cookie{{Name: "id", Value: "1"}})
+	if cookies := jar.Cookies(u); len(cookies) != 1 || cookies[0].Value != "1" {
+		t.Errorf("Cookies: expect the cookie set, has %v", cookies)
+	}
+}
+
+func TestClientCookies(t *testing.T) {
+	router := NewRouter()
+	router.GET("/login", func(w ResponseWriter, r *Request) {
+		SetCookie(w, &Cookie{Name: "session", Value: "s1", Path: "/"})
+		SetCookie(w, &Cookie{Name: "theme", Value: "dark", Path: "/"})
+		w.Header().Set(Location, "/whoami")
+		w.WriteHeader(StatusFound)
+	})
+	router.GET("/whoami", func(w ResponseWriter, r *Request) {
+		for _, c := range r.Cookies() {
+			w.Write([]byte(c.Name + "=" + c.Value + ";"))
+		}
+	})
+	ts := newTestServer(t, router, ServerConfig{})
+	defer ts.Close()
+	c := &Client{Jar: NewCookieJar()}
+	defer c.CloseIdleConnections()
+
+	// The cookies of the redirect response are sent to its location
+	if resp := get(t, c, ts.url+"/login"); string(resp.Body) != "session=s1;theme=dark;" {
+		t.Errorf("Body: expect the cookies set, has %q", resp.Body)
+	}
+	if resp := get(t, c, ts.url+"/whoami"); string(resp.Body) != "session=s1;theme=dark;" {
+		t.Errorf("Body: expect the cookies kept, has %q", resp.Body)
+	}
+}
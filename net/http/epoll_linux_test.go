@@ -0,0 +1,33 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"../../net"
+)
+
+// newEpollTestServer serves router on an epoll event loop
+func newEpollTestServer(tb testing.TB, router *Router, config ServerConfig) *testServer {
+	return newLoopTestServer(tb, router, config, func(s net.TCPServer, h net.LoopHandler, idle time.Duration) (net.Loop, error) {
+		return net.NewEpollLoop(s, h, idle)
+	})
+}
+
+func TestEpollServe(t *testing.T) {
+	testLoopServe(t, newEpollTestServer)
+}
+
+func TestEpollIdleConns(t *testing.T) {
+	testLoopIdleConns(t, newEpollTestServer)
+}
+
+func TestEpollMaxBuffered(t *testing.T) {
+	testLoopMaxBuffered(t, func(s net.TCPServer, h net.LoopHandler, idle time.Duration) (net.Loop, error) {
+		return net.NewEpollLoop(s, h, idle)
+	})
+}
+
+func BenchmarkServeEpoll(b *testing.B) {
+	benchmarkServe(b, newEpollTestServer)
+}
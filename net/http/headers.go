@@ -1,7 +1,9 @@
 package http
 
 import (
-	"strconv"
+	"io"
+	"sort"
+	"strings"
 )
 
 // Hypertext Transfer Protocol (HTTP/1.1): Message Syntax and Routing
@@ -14,6 +16,7 @@ const (
 	AcceptLanguage   headerName = "Accept-Language"
 	Allow            headerName = "Allow"
 	Authorization    headerName = "Authorization"
+	Connection       headerName = "Connection"
 	ContentEncoding  headerName = "Content-Encoding"
 	ContentLanguage  headerName = "Content-Language"
 	ContentLength    headerName = "Content-Length"
@@ -21,54 +24,190 @@ const (
 	ContentType      headerName = "Content-Type"
 	Date             headerName = "Date"
 	Host             headerName = "Host"
+	KeepAlive        headerName = "Keep-Alive"
 	LastModified     headerName = "Last-Modified"
 	Location         headerName = "Location"
 	Referer          headerName = "Referer"
 	RetryAfter       headerName = "Retry-After"
-	Server           headerName = "Server"
+	ServerHeader     headerName = "Server"
 	TransferEncoding headerName = "Transfer-Encoding"
+	Upgrade          headerName = "Upgrade"
 	UserAgent        headerName = "User-Agent"
 	WWWAuthenticate  headerName = "WWW-Authenticate"
+
+	// HTTP State Management Mechanism - RFC 6265
+	CookieHeader    headerName = "Cookie"
+	SetCookieHeader headerName = "Set-Cookie"
 )
 
-// Headers ...
-type Headers struct {
-	version    string
-	statusCode int
-	entities   map[string]string
-	body       string
+// Header allows to store headers, the keys are stored in their canonical
+// format so that they are compared case-insensitively
+type Header map[string][]string
+
+// CanonicalHeaderKey returns the canonical format of a header name: the
+// first letter and the ones following a '-' in upper case, the others in
+// lower case. The name is returned unchanged if it is not a valid token.
+func CanonicalHeaderKey(key string) string {
+	canonical := true
+	upper := true
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !isTokenByte(c) {
+			return key
+		}
+		if upper && 'a' <= c && c <= 'z' || !upper && 'A' <= c && c <= 'Z' {
+			canonical = false
+		}
+		upper = c == '-'
+	}
+	if canonical {
+		return key
+	}
+	b := []byte(key)
+	upper = true
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		} else if !upper && 'A' <= c && c <= 'Z' {
+			b[i] = c - 'A' + 'a'
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+// AddHeader adds value to the values of the key header
+func (h Header) AddHeader(key string, value string) {
+	key = CanonicalHeaderKey(key)
+	h[key] = append(h[key], value)
 }
 
-// NewHeader init the headers structure
-func NewHeader() *Headers {
-	return &Headers{
-		entities: map[string]string{},
+// AddHeaders adds values to the values of the key header
+func (h Header) AddHeaders(key string, values []string) {
+	for _, value := range values {
+		h.AddHeader(key, strings.TrimSpace(value))
 	}
 }
 
-// AddEntity add a new header entity
-func (h *Headers) AddEntity(key headerName, value string) {
-	h.entities[string(key)] = value
+// Add adds value to the values of the key header
+func (h Header) Add(key headerName, value string) {
+	h.AddHeader(string(key), value)
 }
 
-// SetVersion set the version value in headers
-func (h *Headers) SetVersion(version string) { h.version = version }
+// Set replaces the values of the key header by value
+func (h Header) Set(key headerName, value string) {
+	h[CanonicalHeaderKey(string(key))] = []string{value}
+}
 
-// SetStatusCode set the status code value in headers
-func (h *Headers) SetStatusCode(code int) { h.statusCode = code }
+// Get returns the first value of the key header, "" if the header is not set
+func (h Header) Get(key headerName) string {
+	if values := h.Values(key); len(values) != 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns the values of the key header
+func (h Header) Values(key headerName) []string {
+	return h[CanonicalHeaderKey(string(key))]
+}
 
-// SetBody set the body content in headers
-func (h *Headers) SetBody(content string) { h.body = content }
+// Del removes the values of the key header
+func (h Header) Del(key headerName) {
+	delete(h, CanonicalHeaderKey(string(key)))
+}
+
+// IsSet return true if the key has at least a value
+func (h Header) IsSet(key string) bool {
+	return len(h[CanonicalHeaderKey(key)]) != 0
+}
 
-// Bytes return the headers data under []byte format
-func (h Headers) Bytes() []byte {
-	var header string
-	// HTTP/1.1 200 OK\r\nStatus: 200 OK\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: <contentLen>\r\n\r\n<content>"
-	header += "HTTP/" + h.version + " " + StatusString(h.statusCode) + "\r\n"
-	for key, value := range h.entities {
-		header += key + ": " + value + "\r\n"
+// clone returns a copy of the headers
+func (h Header) clone() Header {
+	c := make(Header, len(h))
+	for key, values := range h {
+		c[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+// splitList returns the elements of a comma-separated list header value,
+// the commas of the quoted strings are kept and the empty elements are
+// removed - RFC 7230, 7
+func splitList(value string) []string {
+	var elements []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i <= len(value); i++ {
+		if i < len(value) {
+			switch c := value[i]; {
+			case escaped:
+				escaped = false
+				continue
+			case quoted && c == '\\':
+				escaped = true
+				continue
+			case c == '"':
+				quoted = !quoted
+				continue
+			case c != ',' || quoted:
+				continue
+			}
+		}
+		if element := strings.TrimSpace(value[start:i]); element != "" {
+			elements = append(elements, element)
+		}
+		start = i + 1
+	}
+	return elements
+}
+
+// List returns the elements of the values of a list header like
+// Connection or Transfer-Encoding
+func (h Header) List(key headerName) []string {
+	var elements []string
+	for _, value := range h.Values(key) {
+		elements = append(elements, splitList(value)...)
+	}
+	return elements
+}
+
+// HasToken returns true if one of the elements of the key header is
+// token, compared case-insensitively
+func (h Header) HasToken(key headerName, token string) bool {
+	for _, element := range h.List(key) {
+		if strings.EqualFold(element, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerValueReplacer removes the line breaks which would allow to
+// inject headers
+var headerValueReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// write sends the headers sorted by key, a field line per value, the
+// keys of exclude are skipped
+func (h Header) write(w io.Writer, exclude ...headerName) error {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, key := range keys {
+		excluded := false
+		for _, name := range exclude {
+			excluded = excluded || CanonicalHeaderKey(string(name)) == CanonicalHeaderKey(key)
+		}
+		if excluded {
+			continue
+		}
+		for _, value := range h[key] {
+			buf.WriteString(key + ": " + strings.TrimSpace(headerValueReplacer.Replace(value)) + "\r\n")
+		}
 	}
-	header += string(ContentLength) + ": " + strconv.Itoa(len(h.body)) + "\r\n\r\n"
-	header += string(h.body)
-	return []byte(header)
+	_, err := io.WriteString(w, buf.String())
+	return err
 }
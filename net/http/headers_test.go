@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var canonicalHeaderKeyTests = []struct {
+	key         string // input
+	expected    string // expected result
+	testContent string // test details
+}{
+	{"content-type", "Content-Type", "Lower case"},
+	{"CONTENT-LENGTH", "Content-Length", "Upper case"},
+	{"Www-Authenticate", "Www-Authenticate", "Already canonical"},
+	{"x-forwarded-for", "X-Forwarded-For", "Three words"},
+	{"user agent", "user agent", "Invalid token unchanged"},
+	{"", "", "Empty"},
+}
+
+func TestCanonicalHeaderKey(t *testing.T) {
+	for _, tt := range canonicalHeaderKeyTests {
+		if actual := CanonicalHeaderKey(tt.key); actual != tt.expected {
+			t.Errorf("CanonicalHeaderKey(%q): expect %q, has %q - Test type: \033[31m%s\033[0m", tt.key, tt.expected, actual, tt.testContent)
+		}
+	}
+}
+
+var splitListTests = []struct {
+	value       string   // input
+	expected    []string // expected result
+	testContent string   // test details
+}{
+	{"gzip, chunked", []string{"gzip", "chunked"}, "Two elements"},
+	{"keep-alive,, Upgrade ,", []string{"keep-alive", "Upgrade"}, "Empty elements"},
+	{`a="x, y", b`, []string{`a="x, y"`, "b"}, "Comma in a quoted string"},
+	{`a="x\", y", b`, []string{`a="x\", y"`, "b"}, "Escaped quote"},
+	{"", nil, "Empty value"},
+}
+
+func TestSplitList(t *testing.T) {
+	for _, tt := range splitListTests {
+		if diff := pretty.Compare(splitList(tt.value), tt.expected); diff != "" {
+			t.Errorf("splitList(%q): diff (-has +expect)\n%s - Test type: \033[31m%s\033[0m", tt.value, diff, tt.testContent)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := Header{}
+	h.Set("content-type", "text/plain")
+	h.Add(SetCookieHeader, "a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	h.Add("set-cookie", "b=2")
+	h.AddHeader("connection", "keep-alive, Upgrade")
+
+	if actual := h.Get(ContentType); actual != "text/plain" {
+		t.Errorf("Get: expect %q, has %q", "text/plain", actual)
+	}
+	if actual := h.Values("SET-COOKIE"); len(actual) != 2 {
+		t.Errorf("Values: expect 2 Set-Cookie values, has %q", actual)
+	}
+	if !h.HasToken(Connection, "upgrade") || h.HasToken(Connection, "close") {
+		t.Errorf("hasToken: unexpected result for %q", h.Get(Connection))
+	}
+	var buf bytes.Buffer
+	h.write(&buf, ContentType)
+	expected := "Connection: keep-alive, Upgrade\r\n" +
+		"Set-Cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n" +
+		"Set-Cookie: b=2\r\n"
+	if buf.String() != expected {
+		t.Errorf("write: expect %q, has %q", expected, buf.String())
+	}
+	h.Del("Set-cookie")
+	if h.IsSet("Set-Cookie") {
+		t.Errorf("Del: Set-Cookie still set")
+	}
+}
+
+func TestRequestBytes(t *testing.T) {
+	req, err := NewRequest("POST", "localhost:8085/form?a=1", []byte("x=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(ContentType, "application/x-www-form-urlencoded")
+	req.Header.Add("accept", "text/html")
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Set("X-Injected", "a\r\nEvil: 1")
+	expected := "POST /form?a=1 HTTP/1.1\r\n" +
+		"Host: localhost:8085\r\n" +
+		"User-Agent: Go\r\n" +
+		"Accept: text/html\r\n" +
+		"Accept: text/plain\r\n" +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"X-Injected: a Evil: 1\r\n" +
+		"Content-Length: 3\r\n" +
+		"\r\n" +
+		"x=1"
+	if actual := string(req.Bytes()); actual != expected {
+		t.Errorf("Bytes: expect %q, has %q", expected, actual)
+	}
+}
+
+func TestParseHeadersNoSplit(t *testing.T) {
+	r := InitRequest()
+	r.RequestParse("GET / HTTP/1.1\r\nuser-agent: Mozilla/5.0 (X11; Linux x86_64, like Gecko)\r\nIf-Modified-Since: Wed, 21 Oct 2015 07:28:00 GMT\r\n\r\n")
+	if actual := r.Header.Values(UserAgent); len(actual) != 1 || actual[0] != "Mozilla/5.0 (X11; Linux x86_64, like Gecko)" {
+		t.Errorf("User-Agent: unexpected values %q", actual)
+	}
+	if actual := r.Header.Get("if-modified-since"); actual != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Errorf("If-Modified-Since: unexpected value %q", actual)
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"../../net"
+)
+
+// CookieJar stores in memory the cookies received by a client and returns
+// the ones to send with each request - RFC 6265, 5.3 and 5.4
+// There is no public suffix list, a Domain attribute without a dot is
+// refused. The zero value is an empty jar, a CookieJar is safe for
+// concurrent use.
+type CookieJar struct {
+	mu      sync.Mutex
+	entries map[string]*jarEntry // domain;path;name -> cookie
+	seq     uint64               // creation order of the cookies
+}
+
+type jarEntry struct {
+	cookie   Cookie
+	domain   string
+	hostOnly bool // only sent to the host which set it
+	expires  time.Time
+	seq      uint64
+}
+
+// NewCookieJar returns an empty cookie jar
+func NewCookieJar() *CookieJar {
+	return &CookieJar{entries: map[string]*jarEntry{}}
+}
+
+// domainMatch returns true if host is domain or a subdomain of domain
+// - RFC 6265, 5.1.3
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// defaultPath returns the directory of the request path - RFC 6265, 5.1.4
+func defaultPath(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// pathMatch returns true if the cookie path matches the request path
+// - RFC 6265, 5.1.4
+func pathMatch(requestPath, cookiePath string) bool {
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return len(requestPath) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") ||
+		requestPath[len(cookiePath)] == '/'
+}
+
+// SetCookies stores the cookies received in the response to u, the
+// expired ones are removed from the jar
+func (j *CookieJar) SetCookies(u *URL, cookies []*Cookie) {
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.entries == nil {
+		j.entries = map[string]*jarEntry{}
+	}
+	for _, c := range cookies {
+		e := &jarEntry{cookie: *c, domain: u.Host, hostOnly: true}
+		if c.Domain != "" {
+			domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+			if !strings.Contains(domain, ".") || !domainMatch(u.Host, domain) {
+				continue
+			}
+			e.domain, e.hostOnly = domain, false
+		}
+		if e.cookie.Path == "" || e.cookie.Path[0] != '/' {
+			e.cookie.Path = defaultPath(u.Path)
+		}
+		// Max-Age has precedence over Expires - RFC 6265, 5.3
+		switch {
+		case c.MaxAge > 0:
+			e.expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case c.MaxAge < 0:
+			e.expires = now
+		case !c.Expires.IsZero():
+			e.expires = c.Expires
+		}
+
+		key := e.domain + ";" + e.cookie.Path + ";" + c.Name
+		if !e.expires.IsZero() && !e.expires.After(now) {
+			delete(j.entries, key)
+			continue
+		}
+		if old, ok := j.entries[key]; ok {
+			e.seq = old.seq
+		} else {
+			j.seq++
+			e.seq = j.seq
+		}
+		j.entries[key] = e
+	}
+}
+
+// Cookies returns the cookies to send with a request to u, the ones with
+// the longest path first - RFC 6265, 5.4
+func (j *CookieJar) Cookies(u *URL) []*Cookie {
+	now := time.Now()
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	j.mu.Lock()
+	var selected []*jarEntry
+	for key, e := range j.entries {
+		if !e.expires.IsZero() && !e.expires.After(now) {
+			delete(j.entries, key)
+			continue
+		}
+		if e.hostOnly && u.Host != e.domain || !e.hostOnly && !domainMatch(u.Host, e.domain) {
+			continue
+		}
+		if !pathMatch(path, e.cookie.Path) || e.cookie.Secure && u.Scheme != "https" {
+			continue
+		}
+		selected = append(selected, e)
+	}
+	j.mu.Unlock()
+
+	sort.Slice(selected, func(a, b int) bool {
+		if len(selected[a].cookie.Path) != len(selected[b].cookie.Path) {
+			return len(selected[a].cookie.Path) > len(selected[b].cookie.Path)
+		}
+		return selected[a].seq < selected[b].seq
+	})
+	cookies := make([]*Cookie, len(selected))
+	for i, e := range selected {
+		cookies[i] = &Cookie{Name: e.cookie.Name, Value: e.cookie.Value}
+	}
+	return cookies
+}
@@ -0,0 +1,309 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	gonet "net"
+	"time"
+
+	"../../net"
+)
+
+// Serving the connections on an event loop: the data received is
+// buffered in the connection until a whole request is available, the
+// request is then answered by its handler on a new goroutine and the
+// response is sent by the loop as the handler flushes it. An idle
+// connection uses no goroutine.
+
+// errIncomplete is returned by parseBuffered when more data is needed
+var errIncomplete = errors.New("incomplete request")
+
+// loopConnState is the state of a connection served by an event loop
+type loopConnState struct {
+	served int // number of requests received
+
+	// * The progress of the request being received is kept between the
+	// reads so that the data buffered is scanned once
+	scanned int      // offset from which a delimiter is searched
+	header  *Request // headers of the request being received, nil if incomplete
+	body    int      // offset of the body in the buffer
+	chunk   int      // offset of the next chunk in the buffer
+	decoded int64    // size of the chunks received
+}
+
+// scanHeader parses the headers of the request buffered in data once they
+// are complete, errIncomplete is returned if more data is needed
+func (st *loopConnState) scanHeader(data []byte, config ServerConfig) error {
+	start := 0
+	for bytes.HasPrefix(data[start:], []byte("\r\n")) {
+		start += 2
+	}
+	from := start
+	if st.scanned > from {
+		from = st.scanned
+	}
+	end := bytes.Index(data[from:], []byte("\r\n\r\n"))
+	if end == -1 {
+		if len(data)-start > config.maxHeaderBytes() {
+			return errHeaderTooLarge
+		}
+		// The delimiter can be split between two reads
+		st.scanned = len(data) - 3
+		return errIncomplete
+	}
+	end += from
+	st.header = InitRequest()
+	st.header.parseHeaders(string(data[start:end]))
+	st.body, st.chunk, st.scanned = end+4, end+4, 0
+	return nil
+}
+
+// bodyComplete returns false if the body of the request whose headers have
+// been scanned is not fully buffered in data. The chunks are decoded as
+// they are received to answer a body too large without buffering it.
+func (st *loopConnState) bodyComplete(data []byte, config ServerConfig) (bool, error) {
+	r := st.header
+	if r.ContentLength < 0 {
+		// The error is answered without reading the body
+		return true, nil
+	}
+	if len(r.Header.Values(TransferEncoding)) == 0 {
+		if r.ContentLength > config.maxBodyBytes() {
+			return true, nil
+		}
+		return int64(len(data)-st.body) >= r.ContentLength, nil
+	}
+	for {
+		i := bytes.Index(data[st.chunk:], []byte("\r\n"))
+		if i == -1 {
+			// A line too long is answered by readRequest
+			return len(data)-st.chunk > maxChunkLineBytes, nil
+		}
+		size, err := parseChunkSize(string(data[st.chunk : st.chunk+i]))
+		if err != nil {
+			return true, nil
+		}
+		if size == 0 {
+			break
+		}
+		if st.decoded+size > config.maxBodyBytes() {
+			return false, errBodyTooLarge
+		}
+		next := st.chunk + i + 2 + int(size) + 2
+		if next > len(data) {
+			return false, nil
+		}
+		st.decoded += size
+		st.chunk = next
+	}
+	// The trailer ends with an empty line, the CRLF of the last chunk is
+	// its first half when it has no field
+	from := st.chunk + bytes.Index(data[st.chunk:], []byte("\r\n"))
+	if st.scanned > from {
+		from = st.scanned
+	}
+	if bytes.Contains(data[from:], []byte("\r\n\r\n")) || len(data)-st.chunk > config.maxHeaderBytes() {
+		return true, nil
+	}
+	st.scanned = len(data) - 3
+	return false, nil
+}
+
+// parseBuffered parses the first request of data, it returns the request
+// and the number of bytes it uses, errIncomplete if more data is needed
+func (st *loopConnState) parseBuffered(data []byte, config ServerConfig) (*Request, int, error) {
+	if st.header == nil {
+		if err := st.scanHeader(data, config); err != nil {
+			return nil, 0, err
+		}
+	}
+	if complete, err := st.bodyComplete(data, config); err != nil || !complete {
+		if err == nil {
+			err = errIncomplete
+		}
+		return nil, 0, err
+	}
+
+	src := bytes.NewReader(data)
+	cr := newConnReader(src)
+	r, err := readRequest(cr, config)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// * A chunk can contain the delimiter of the trailer
+		st.scanned = len(data) - 3
+		return nil, 0, errIncomplete
+	}
+	*st = loopConnState{served: st.served}
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, len(data) - src.Len() - len(cr.buf), nil
+}
+
+// loopOutputLimit is the size of the output of a connection beyond which
+// a handler writing a response waits for the loop to send it
+const loopOutputLimit = 256 << 10 // 256 KB
+
+// loopWriter is the connection of the responses served on an event loop,
+// the data flushed is sent by the loop as it is written
+type loopWriter struct {
+	loop net.Loop
+	c    *net.LoopConn
+}
+
+// Write queues data on the connection, it waits while the output is above
+// loopOutputLimit so that a large response is not kept in memory
+func (lw loopWriter) Write(data []byte) (int, error) {
+	done := make(chan error, 1)
+	lw.loop.Post(func() {
+		if lw.c.Closed() {
+			done <- gonet.ErrClosed
+			return
+		}
+		lw.c.Write(data)
+		if lw.c.Buffered() <= loopOutputLimit {
+			done <- nil
+			return
+		}
+		lw.c.WhenDrained(func() {
+			if lw.c.Closed() {
+				done <- gonet.ErrClosed
+				return
+			}
+			done <- nil
+		})
+	})
+	if err := <-done; err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// maxBuffered is the size of the data buffered for a connection beyond
+// which it is answered with 413 and closed
+func (s *server) maxBuffered() int {
+	return s.config.maxHeaderBytes() + int(s.config.maxBodyBytes())
+}
+
+// loopHandler returns the callbacks serving HTTP on an event loop
+func (s *server) loopHandler() net.LoopHandler {
+	return net.LoopHandler{
+		MaxBuffered: s.maxBuffered(),
+		OnOpen: func(c *net.LoopConn) {
+			c.Context = &loopConnState{}
+			c.Deadline = time.Now().Add(s.config.idleTimeout())
+		},
+		OnData: s.serveLoopConn,
+		OnClose: func(c *net.LoopConn) {
+			c.In = nil
+		},
+	}
+}
+
+// serveLoopConn parses the next request received on c and starts its
+// handler, it is called on the goroutine of the loop
+func (s *server) serveLoopConn(c *net.LoopConn) {
+	if c.Closed() {
+		return
+	}
+	if !c.Busy && len(c.In) == 0 && s.isClosing() {
+		// No new request once the server is shutting down, the one being
+		// received is answered with Connection: close
+		c.Close()
+		return
+	}
+	overLimit := len(c.In) > s.maxBuffered()
+	if c.Busy {
+		// The next request is parsed once the response is sent
+		if overLimit {
+			c.In = nil
+			c.Close()
+		}
+		return
+	}
+	state := c.Context.(*loopConnState)
+	r, n, err := state.parseBuffered(c.In, s.config)
+	if state.header != nil || err == nil {
+		// * The headers are received before the deadline, the body only
+		// within the idle timeout between two reads
+		c.Deadline = time.Time{}
+	}
+	if overLimit {
+		// The loop does not read the connection anymore
+		if r != nil && r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
+		}
+		err = errBodyTooLarge
+	} else if err == errIncomplete {
+		return
+	}
+	if err != nil {
+		if e, ok := err.(statusError); ok {
+			var buf bytes.Buffer
+			writeError(&buf, e)
+			c.Write(buf.Bytes())
+		} else {
+			fmt.Println("Read:", err)
+		}
+		c.In = nil
+		c.Close()
+		return
+	}
+	c.In = c.In[n:]
+	state.served++
+	keepAlive := r.keepAlive() && state.served < s.config.maxRequestsPerConn()
+
+	c.Busy = true
+	go func() {
+		w := newResponse(loopWriter{s.loop, c}, r, keepAlive)
+		w.closing = s.isClosing
+		w.hijack = func() (gonet.Conn, []byte, error) {
+			return s.hijackLoopConn(c)
+		}
+
+		fmt.Println("Message:", r.Method, r.RequestURI)
+		s.router.serve(w, r)
+		if r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
+		}
+		if w.hijacked {
+			return
+		}
+		if err := w.finish(); err != nil {
+			fmt.Println("Write:", err)
+		}
+		s.loop.Post(func() {
+			c.Busy = false
+			if w.closeAfter {
+				c.Close()
+				return
+			}
+			// The next request must be received within the idle timeout
+			c.Deadline = time.Now().Add(s.config.idleTimeout())
+			// A pipelined request may already be buffered
+			s.serveLoopConn(c)
+		})
+	}()
+}
+
+// hijackLoopConn removes c from the event loop and returns it with the
+// data received after the request, it is called by the handler goroutine
+func (s *server) hijackLoopConn(c *net.LoopConn) (gonet.Conn, []byte, error) {
+	type detached struct {
+		conn     net.Conn
+		buffered []byte
+		err      error
+	}
+	done := make(chan detached, 1)
+	s.loop.Post(func() {
+		conn, err := c.Detach()
+		done <- detached{conn, c.In, err}
+		c.In = nil
+	})
+	d := <-done
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return &d.conn, d.buffered, nil
+}
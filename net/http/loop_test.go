@@ -0,0 +1,299 @@
+package http
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"../../net"
+	"golang.org/x/sys/unix"
+)
+
+// newLoopFunc is the constructor of a net.Loop
+type newLoopFunc func(net.TCPServer, net.LoopHandler, time.Duration) (net.Loop, error)
+
+// newLoopTestServer serves router on the event loop returned by newLoop
+func newLoopTestServer(tb testing.TB, router *Router, config ServerConfig, newLoop newLoopFunc) *testServer {
+	socket, url := listenLocal(tb)
+	ts := &testServer{socket: socket, url: url}
+	s := &server{socket: socket, router: router, config: config}
+	handler := s.loopHandler()
+	onOpen := handler.OnOpen
+	handler.OnOpen = func(c *net.LoopConn) {
+		atomic.AddInt32(&ts.accepted, 1)
+		onOpen(c)
+	}
+	l, err := newLoop(socket, handler, config.idleTimeout())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s.loop, ts.loop = l, l
+	go l.Run()
+	return ts
+}
+
+// rawExchange sends raw on a new connection to ts and returns what is
+// received until the server closes the connection
+func rawExchange(t *testing.T, ts *testServer, raw string) string {
+	port := ts.url[strings.LastIndexByte(ts.url, ':')+1:]
+	u := &URL{Host: "127.0.0.1", Port: port}
+	c, err := dial(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadTimeout(2 * time.Second)
+	if _, err = c.Write([]byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(&c)
+	return string(data)
+}
+
+func newEchoRouter() *Router {
+	router := newPoolRouter()
+	router.POST("/echo", func(w ResponseWriter, r *Request) {
+		w.Write(r.Body)
+	})
+	return router
+}
+
+// testLoopServe checks the requests served by the server of newServer
+func testLoopServe(t *testing.T, newServer func(testing.TB, *Router, ServerConfig) *testServer) {
+	ts := newServer(t, newEchoRouter(), ServerConfig{MaxBodyBytes: 1 << 20})
+	defer ts.Close()
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	for i := 0; i < 3; i++ {
+		if resp := get(t, c, ts.url+"/hello"); string(resp.Body) != "hello" {
+			t.Errorf("Body: expect %q, has %q", "hello", resp.Body)
+		}
+	}
+	if n := atomic.LoadInt32(&ts.accepted); n != 1 {
+		t.Errorf("Connections: expect 1, has %d - Test type: \033[31m%s\033[0m", n, "Keep-alive")
+	}
+	large := strings.Repeat("x", 300000)
+	req, _ := NewRequest("POST", ts.url+"/echo", []byte(large))
+	if resp, err := c.Do(&req); err != nil || string(resp.Body) != large {
+		t.Errorf("Do: expect the large body echoed, has %v", err)
+	}
+
+	tests := []struct {
+		raw         string   // requests sent
+		contains    []string // expected in the responses, in order
+		testContent string   // test details
+	}{
+		{
+			"GET /hello HTTP/1.1\r\n\r\nPOST /echo HTTP/1.1\r\nContent-Length: 4\r\n\r\npipeGET /close HTTP/1.1\r\n\r\n",
+			[]string{"\r\n\r\nhello", "\r\n\r\npipe", "\r\n\r\nbye"}, "Pipelined requests",
+		},
+		{
+			"POST /echo HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\nGET /close HTTP/1.1\r\n\r\n",
+			[]string{"\r\n\r\nhello world", "\r\n\r\nbye"}, "Chunked body",
+		},
+		{
+			"POST /echo HTTP/1.1\r\nContent-Length: 2000000\r\n\r\n",
+			[]string{"413 Request Entity Too Large"}, "Body too large",
+		},
+		{
+			"POST /echo HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n200000\r\n" + strings.Repeat("z", 1000),
+			[]string{"413 Request Entity Too Large"}, "Chunked body too large",
+		},
+		{
+			"GET /hello HTTP/1.0\r\n\r\n",
+			[]string{"Connection: close", "\r\n\r\nhello"}, "HTTP/1.0 closed",
+		},
+	}
+	for _, tt := range tests {
+		actual := rawExchange(t, ts, tt.raw)
+		rest := actual
+		for _, s := range tt.contains {
+			i := strings.Index(rest, s)
+			if i == -1 {
+				t.Errorf("Response %q: expect %q - Test type: \033[31m%s\033[0m", actual, s, tt.testContent)
+				break
+			}
+			rest = rest[i+len(s):]
+		}
+	}
+}
+
+// testLoopIdleConns checks that the idle connections of the server of
+// newServer do not use goroutines and are closed after the idle timeout
+func testLoopIdleConns(t *testing.T, newServer func(testing.TB, *Router, ServerConfig) *testServer) {
+	const conns = 500
+	ts := newServer(t, newPoolRouter(), ServerConfig{IdleTimeout: time.Second})
+	defer ts.Close()
+	port := ts.url[strings.LastIndexByte(ts.url, ':')+1:]
+
+	before := runtime.NumGoroutine()
+	var clients []net.Conn
+	for i := 0; i < conns; i++ {
+		c, err := dial(&URL{Host: "127.0.0.1", Port: port})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+		// Let the loop accept before the listen queue is full
+		for i%50 == 49 && atomic.LoadInt32(&ts.accepted) <= int32(i) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before+10 {
+		t.Errorf("Goroutines: expect about %d for %d idle connections, has %d", before, conns, after)
+	}
+	// Every connection is still served
+	for _, c := range clients[:50] {
+		c.Write([]byte("GET /hello HTTP/1.1\r\n\r\n"))
+		resp, err := readResponse(newConnReader(&c), &Request{Method: "GET"})
+		if err != nil || string(resp.Body) != "hello" {
+			t.Fatalf("readResponse: expect hello, has %v %v", resp, err)
+		}
+	}
+	// The idle connections are closed by the server
+	time.Sleep(2 * time.Second)
+	var buf [1]byte
+	n, err := unix.Read(clients[0].Fd, buf[:])
+	if n != 0 || err != nil {
+		t.Errorf("Read: expect the connection closed, has %d %v", n, err)
+	}
+}
+
+// benchmarkServe sends b.N requests with parallel keep-alive clients
+func benchmarkServe(b *testing.B, newServer func(testing.TB, *Router, ServerConfig) *testServer) {
+	// The server prints each request
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	defer func() { os.Stdout = stdout }()
+
+	ts := newServer(b, newPoolRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{MaxIdleConnsPerHost: 64}
+	defer c.CloseIdleConnections()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req, _ := NewRequest("GET", ts.url+"/hello", nil)
+			if _, err := c.Do(&req); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkServeGoroutine(b *testing.B) {
+	benchmarkServe(b, newTestServer)
+}
+
+// newSelectTestServer serves router on a select event loop
+func newSelectTestServer(tb testing.TB, router *Router, config ServerConfig) *testServer {
+	return newLoopTestServer(tb, router, config, func(s net.TCPServer, h net.LoopHandler, idle time.Duration) (net.Loop, error) {
+		return net.NewSelectLoop(s, h, idle)
+	})
+}
+
+func TestParseBuffered(t *testing.T) {
+	config := ServerConfig{MaxBodyBytes: 4096}
+	chunk := "400\r\n" + strings.Repeat("c", 1024) + "\r\n"
+	tests := []struct {
+		raw         string // data received
+		body        string // expected body
+		err         error  // expected error once all the data is received
+		testContent string // test details
+	}{
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello", "hello", nil, "Content-Length"},
+		{"\r\nPOST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\n\r\n\r\r\n0\r\nX-Sum: 1\r\n\r\n", "\r\n\r", nil, "Chunk containing the delimiter"},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" + strings.Repeat(chunk, 4) + "0\r\n\r\n", strings.Repeat("c", 4096), nil, "Chunks at the limit"},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" + strings.Repeat(chunk, 200), "", errBodyTooLarge, "Chunks too large"},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", "", errMalformedChunk, "Invalid chunk size"},
+	}
+	for _, tt := range tests {
+		// The data is received byte by byte, the state is kept between reads
+		st := &loopConnState{}
+		var r *Request
+		var err error
+		for i := 1; i <= len(tt.raw); i++ {
+			if r, _, err = st.parseBuffered([]byte(tt.raw[:i]), config); err != errIncomplete {
+				break
+			}
+		}
+		if err != tt.err {
+			t.Errorf("parseBuffered: expect error %v, has %v - Test type: \033[31m%s\033[0m", tt.err, err, tt.testContent)
+			continue
+		}
+		if err == nil && string(r.Body) != tt.body {
+			t.Errorf("parseBuffered: expect body %q, has %q - Test type: \033[31m%s\033[0m", tt.body, r.Body, tt.testContent)
+		}
+	}
+}
+
+// testLoopMaxBuffered checks that the loop of newLoop stops reading a
+// connection once its buffer is beyond MaxBuffered
+func testLoopMaxBuffered(t *testing.T, newLoop newLoopFunc) {
+	const maxBuffered = 1000
+	socket, url := listenLocal(t)
+	var largest int64
+	handler := net.LoopHandler{
+		MaxBuffered: maxBuffered,
+		OnData: func(c *net.LoopConn) {
+			atomic.StoreInt64(&largest, int64(len(c.In)))
+			if len(c.In) > maxBuffered {
+				c.Close()
+			}
+		},
+	}
+	l, err := newLoop(socket, handler, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.Run()
+	defer l.Stop()
+
+	port := url[strings.LastIndexByte(url, ':')+1:]
+	c, err := dial(&URL{Host: "127.0.0.1", Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetReadTimeout(2 * time.Second)
+	// The data is sent faster than the loop reads it
+	written := make(chan struct{})
+	go func() {
+		c.Write(make([]byte, 4<<20))
+		close(written)
+	}()
+	ioutil.ReadAll(&c)
+	// * The fd must not be closed while written to, it can be reused by
+	// the connection of another test
+	<-written
+	// * A read of the loop can pass the limit by the size of its buffer
+	if n := atomic.LoadInt64(&largest); n > maxBuffered+64<<10 {
+		t.Errorf("Buffered: expect at most %d bytes, has %d", maxBuffered+64<<10, n)
+	}
+}
+
+func TestSelectMaxBuffered(t *testing.T) {
+	testLoopMaxBuffered(t, func(s net.TCPServer, h net.LoopHandler, idle time.Duration) (net.Loop, error) {
+		return net.NewSelectLoop(s, h, idle)
+	})
+}
+
+func TestSelectServe(t *testing.T) {
+	testLoopServe(t, newSelectTestServer)
+}
+
+func TestSelectIdleConns(t *testing.T) {
+	testLoopIdleConns(t, newSelectTestServer)
+}
+
+func BenchmarkServeSelect(b *testing.B) {
+	benchmarkServe(b, newSelectTestServer)
+}
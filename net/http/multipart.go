@@ -0,0 +1,364 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returning Values from Forms: multipart/form-data
+// https://tools.ietf.org/html/rfc7578
+
+// DefaultMaxMemory is the size of the multipart form parts kept in memory,
+// beyond it the files are stored in temporary files
+const DefaultMaxMemory = 1 << 20 // 1 MB
+
+const maxPartHeaderBytes = 10 << 10 // 10 KB
+
+var (
+	errMalformedMultipart = errors.New("multipart: malformed form")
+	errMultipartTooLarge  = errors.New("multipart: values too large")
+)
+
+// MultipartForm stores the values and the files of a multipart form
+type MultipartForm struct {
+	Value Values
+	File  map[string][]*FileHeader
+}
+
+// FileHeader describes a file of a multipart form
+type FileHeader struct {
+	Filename string
+	Header   Header
+	Size     int64
+
+	content []byte // in memory content
+	tmpfile string // temporary file storing the content
+}
+
+// File is the content of an uploaded file
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// Open returns the content of the file
+func (fh *FileHeader) Open() (File, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return memoryFile{bytes.NewReader(fh.content)}, nil
+}
+
+// RemoveAll removes the temporary files of the form
+func (f *MultipartForm) RemoveAll() error {
+	var err error
+	for _, files := range f.File {
+		for _, fh := range files {
+			if fh.tmpfile == "" {
+				continue
+			}
+			if e := os.Remove(fh.tmpfile); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// parseHeaderParams splits a header value like a media type or a
+// Content-Disposition in a lower case value and its parameters
+// type/subtype *( ";" name "=" ( token / quoted-string ) )
+func parseHeaderParams(header string) (string, map[string]string) {
+	params := map[string]string{}
+	var fields []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(header); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && header[i] == '\\':
+			escaped = true
+		case header[i] == '"':
+			quoted = !quoted
+		case header[i] == ';' && !quoted:
+			fields = append(fields, header[start:i])
+			start = i + 1
+		}
+	}
+	fields = append(fields, header[start:])
+
+	for _, field := range fields[1:] {
+		nameValue := strings.SplitN(field, "=", 2)
+		if len(nameValue) != 2 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(nameValue[0]))
+		value := strings.TrimSpace(nameValue[1])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			var buf strings.Builder
+			for i := 1; i < len(value)-1; i++ {
+				if value[i] == '\\' && i+1 < len(value)-1 {
+					i++
+				}
+				buf.WriteByte(value[i])
+			}
+			value = buf.String()
+		}
+		params[name] = value
+	}
+	return strings.ToLower(strings.TrimSpace(fields[0])), params
+}
+
+func (r *Request) getMultipartBoundaryDelimiter() string {
+	mediaType, params := parseHeaderParams(r.Header.Get(ContentType))
+	if mediaType != "multipart/form-data" {
+		return ""
+	}
+	return params["boundary"]
+}
+
+// multipartReader reads the parts of a multipart body as they are received
+type multipartReader struct {
+	br        *bufio.Reader
+	boundary  string
+	delimiter []byte // "\r\n--" boundary, ending the content of a part
+	part      *part
+	started   bool
+	done      bool
+}
+
+// part is a part of a multipart body, its content is read with Read
+type part struct {
+	mr     *multipartReader
+	header Header
+	eof    bool
+}
+
+func newMultipartReader(src io.Reader, boundary string) *multipartReader {
+	return &multipartReader{
+		br:        bufio.NewReaderSize(src, 4096),
+		boundary:  boundary,
+		delimiter: []byte("\r\n--" + boundary),
+	}
+}
+
+// readLine returns the next line without its end of line
+func (mr *multipartReader) readLine() (string, error) {
+	line, err := mr.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errMalformedMultipart
+	}
+	if err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// nextPart returns the next part of the body, io.EOF after the last one
+func (mr *multipartReader) nextPart() (*part, error) {
+	if mr.done {
+		return nil, io.EOF
+	}
+	if mr.part != nil && !mr.part.eof {
+		if _, err := io.Copy(ioutil.Discard, mr.part); err != nil {
+			return nil, err
+		}
+	}
+	if !mr.started {
+		// Skip the preamble until the first boundary
+		mr.started = true
+		for {
+			line, err := mr.readLine()
+			if err != nil {
+				return nil, err
+			}
+			line = strings.TrimRight(line, " \t")
+			if line == "--"+mr.boundary {
+				break
+			}
+			if line == "--"+mr.boundary+"--" {
+				mr.done = true
+				return nil, io.EOF
+			}
+		}
+	} else {
+		// The rest of the boundary line after the delimiter
+		line, err := mr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "--") {
+			mr.done = true
+			return nil, io.EOF
+		}
+	}
+
+	p := &part{mr: mr, header: Header{}}
+	var size int
+	for {
+		line, err := mr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		if size += len(line); size > maxPartHeaderBytes {
+			return nil, errMalformedMultipart
+		}
+		key, value, ok := parseHeaderField(line)
+		if !ok {
+			return nil, errMalformedMultipart
+		}
+		p.header.AddHeader(key, value)
+	}
+	mr.part = p
+	return p, nil
+}
+
+// Read reads the content of the part until the next delimiter
+func (p *part) Read(b []byte) (int, error) {
+	if p.eof {
+		return 0, io.EOF
+	}
+	br := p.mr.br
+	delimiter := p.mr.delimiter
+	buf, err := br.Peek(br.Size())
+	if i := bytes.Index(buf, delimiter); i != -1 {
+		if i == 0 {
+			br.Discard(len(delimiter))
+			p.eof = true
+			return 0, io.EOF
+		}
+		n := copy(b, buf[:i])
+		br.Discard(n)
+		return n, nil
+	}
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err != nil && err != bufio.ErrBufferFull {
+		return 0, err
+	}
+	// The end of the buffer can be the start of the delimiter
+	n := copy(b, buf[:len(buf)-len(delimiter)+1])
+	br.Discard(n)
+	return n, nil
+}
+
+// formName returns the name and the filename of the form field of the part
+func (p *part) formName() (name, filename string) {
+	disposition, params := parseHeaderParams(p.header.Get("Content-Disposition"))
+	if disposition != "form-data" {
+		return "", ""
+	}
+	filename = params["filename"]
+	if filename != "" {
+		filename = filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	}
+	return params["name"], filename
+}
+
+// readForm reads the values and the files of the body, the parts beyond
+// maxMemory are stored in temporary files
+func (mr *multipartReader) readForm(maxMemory int64) (*MultipartForm, error) {
+	form := &MultipartForm{Value: Values{}, File: map[string][]*FileHeader{}}
+	for {
+		p, err := mr.nextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		name, filename := p.formName()
+		if name == "" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if filename == "" {
+			n, err := io.CopyN(&buf, p, maxMemory+1)
+			if err != nil && err != io.EOF {
+				form.RemoveAll()
+				return nil, err
+			}
+			if maxMemory -= n; maxMemory < 0 {
+				form.RemoveAll()
+				return nil, errMultipartTooLarge
+			}
+			form.Value.AddValue(name, buf.String())
+			continue
+		}
+
+		fh := &FileHeader{Filename: filename, Header: p.header}
+		n, err := io.CopyN(&buf, p, maxMemory+1)
+		if err != nil && err != io.EOF {
+			form.RemoveAll()
+			return nil, err
+		}
+		if n > maxMemory {
+			// Too large to stay in memory, store the file on disk
+			f, err := ioutil.TempFile("", "multipart-")
+			if err != nil {
+				form.RemoveAll()
+				return nil, err
+			}
+			size, err := io.Copy(f, io.MultiReader(&buf, p))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(f.Name())
+				form.RemoveAll()
+				return nil, err
+			}
+			fh.tmpfile = f.Name()
+			fh.Size = size
+		} else {
+			fh.content = buf.Bytes()
+			fh.Size = n
+			maxMemory -= n
+		}
+		form.File[name] = append(form.File[name], fh)
+	}
+}
+
+// readMultipartForm stores the values and the files of a multipart body
+// read from body
+func (r *Request) readMultipartForm(body io.Reader, maxMemory int64) error {
+	boundary := r.getMultipartBoundaryDelimiter()
+	if boundary == "" {
+		return errMalformedMultipart
+	}
+	form, err := newMultipartReader(body, boundary).readForm(maxMemory)
+	if err != nil {
+		return err
+	}
+	r.MultipartForm = form
+	for name, values := range form.Value {
+		for _, value := range values {
+			r.PostForm.AddValue(name, value)
+		}
+	}
+	return nil
+}
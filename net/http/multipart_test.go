@@ -0,0 +1,163 @@
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// multipartRequest returns a request sending body as a multipart form
+func multipartRequest(body string) string {
+	return "POST /upload HTTP/1.1\r\n" +
+		"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+var uploadBody = "preamble\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n\r\n" +
+	"My \"files\"\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"doc\"; filename=\"C:\\\\Users\\\\ava\\\\notes.txt\"\r\n" +
+	"Content-Type: text/plain\r\n\r\n" +
+	"line 1\r\nline 2 --XyZ not a delimiter\r\n" +
+	"--XyZ\r\n" +
+	"Content-Disposition: form-data; name=\"doc\"; filename=\"big.bin\"\r\n" +
+	"Content-Type: application/octet-stream\r\n\r\n" +
+	strings.Repeat("0123456789", 1000) + "\r\n" +
+	"--XyZ--\r\n" +
+	"epilogue"
+
+func TestReadMultipartForm(t *testing.T) {
+	raw := multipartRequest(uploadBody) + "GET /next HTTP/1.1\r\n\r\n"
+	cr := newConnReader(iotest.OneByteReader(strings.NewReader(raw)))
+	r, err := readRequest(cr, ServerConfig{MaxMemory: 1024})
+	if err != nil {
+		t.Fatalf("readRequest: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if diff := pretty.Compare(r.PostForm, Values{"title": {"My \"files\""}}); diff != "" {
+		t.Errorf("PostForm: %s", diff)
+	}
+	files := r.MultipartForm.File["doc"]
+	if len(files) != 2 {
+		t.Fatalf("File: expect 2 files, has %d", len(files))
+	}
+	expected := []struct {
+		filename string
+		content  string
+		onDisk   bool
+	}{
+		{"notes.txt", "line 1\r\nline 2 --XyZ not a delimiter", false},
+		{"big.bin", strings.Repeat("0123456789", 1000), true},
+	}
+	for i, fh := range files {
+		if fh.Filename != expected[i].filename || fh.Size != int64(len(expected[i].content)) {
+			t.Errorf("FileHeader: expect %s %d, has %s %d", expected[i].filename, len(expected[i].content), fh.Filename, fh.Size)
+		}
+		if (fh.tmpfile != "") != expected[i].onDisk {
+			t.Errorf("FileHeader %s: expect on disk %v", fh.Filename, expected[i].onDisk)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(content) != expected[i].content {
+			t.Errorf("FileHeader %s: unexpected content %q", fh.Filename, content)
+		}
+	}
+	tmpfile := files[1].tmpfile
+	r.MultipartForm.RemoveAll()
+	if _, err := os.Stat(tmpfile); !os.IsNotExist(err) {
+		t.Errorf("RemoveAll: %s still exists", tmpfile)
+	}
+
+	// The connection stays usable for the next request
+	next, err := readRequest(cr, ServerConfig{})
+	if err != nil || next.URL.Path != "/next" {
+		t.Errorf("readRequest after multipart: %v", err)
+	}
+}
+
+func TestReadMultipartFormChunked(t *testing.T) {
+	raw := "POST /upload HTTP/1.1\r\n" +
+		"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+		"Transfer-Encoding: chunked\r\n\r\n" +
+		strconv.FormatInt(int64(len(uploadBody)), 16) + "\r\n" + uploadBody + "\r\n0\r\n\r\n"
+	cr := newConnReader(strings.NewReader(raw))
+	r, err := readRequest(cr, ServerConfig{MaxMemory: 1024})
+	if err != nil {
+		t.Fatalf("readRequest: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	// The maximum memory of the server applies to the chunked bodies
+	files := r.MultipartForm.File["doc"]
+	if len(files) != 2 {
+		t.Fatalf("File: expect 2 files, has %d", len(files))
+	}
+	if files[0].tmpfile != "" || files[1].tmpfile == "" {
+		t.Errorf("FileHeader: expect only %s on disk, has %q %q", files[1].Filename, files[0].tmpfile, files[1].tmpfile)
+	}
+}
+
+func TestReadMultipartFormErrors(t *testing.T) {
+	tests := []struct {
+		body        string       // multipart body
+		config      ServerConfig // server limits
+		testContent string       // test details
+	}{
+		{"--XyZ\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue", ServerConfig{}, "Missing final boundary"},
+		{"--XyZ\r\nbad header\r\n\r\nvalue\r\n--XyZ--", ServerConfig{}, "Invalid part header"},
+		{"no boundary at all", ServerConfig{}, "No boundary"},
+		{"--XyZ\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\n" + strings.Repeat("a", 100) + "\r\n--XyZ--", ServerConfig{MaxMemory: 10}, "Value too large"},
+	}
+	for _, tt := range tests {
+		cr := newConnReader(strings.NewReader(multipartRequest(tt.body)))
+		if _, err := readRequest(cr, tt.config); err != errBadMultipart {
+			t.Errorf("readRequest: expect %v, has %v - Test type: \033[31m%s\033[0m", errBadMultipart, err, tt.testContent)
+		}
+	}
+}
+
+func TestReadMultipartFormEpilogueError(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	// The connection fails while the epilogue is drained, once the files are stored
+	raw := multipartRequest(uploadBody + strings.Repeat("e", 100))
+	src := io.MultiReader(strings.NewReader(raw[:len(raw)-50]), iotest.ErrReader(iotest.ErrTimeout))
+	r, err := readRequest(newConnReader(src), ServerConfig{MaxMemory: 1024})
+	if err != iotest.ErrTimeout {
+		t.Errorf("readRequest: expect %v, has %v", iotest.ErrTimeout, err)
+	}
+	if r != nil && r.MultipartForm != nil {
+		t.Errorf("MultipartForm: expect nil, has %v", r.MultipartForm)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("RemoveAll: expect no temporary file, has %d", len(files))
+	}
+}
+
+func TestParseHeaderParams(t *testing.T) {
+	value, params := parseHeaderParams(`Form-Data; name="a;b"; filename="say \"hi\".txt"; size=12`)
+	if value != "form-data" {
+		t.Errorf("parseHeaderParams: expect form-data, has %s", value)
+	}
+	diff := pretty.Compare(params, map[string]string{
+		"name":     "a;b",
+		"filename": `say "hi".txt`,
+		"size":     "12",
+	})
+	if diff != "" {
+		t.Error(diff)
+	}
+}
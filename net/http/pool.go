@@ -0,0 +1,386 @@
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	gonet "net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultMaxIdleConns is the maximum number of idle connections kept
+	// by a client for all the hosts
+	DefaultMaxIdleConns = 100
+	// DefaultMaxIdleConnsPerHost is the maximum number of idle connections
+	// kept by a client for a host
+	DefaultMaxIdleConnsPerHost = 2
+	// DefaultIdleConnTimeout is the time an idle connection is kept open
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// Client sends requests and keeps the connections open between them so
+// that they are reused by the next requests to the same host.
+// A Client is safe for concurrent use, its zero value uses the defaults.
+type Client struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the number of connections open to a host,
+	// the requests wait for a connection once reached, 0 means no limit
+	MaxConnsPerHost int
+	IdleConnTimeout time.Duration
+
+	// CheckRedirect is called before following a redirect with the next
+	// request and the requests already sent, the oldest first. If it
+	// returns an error the redirect is not followed and Do returns the
+	// error, or the redirect response for ErrUseLastResponse.
+	CheckRedirect func(req *Request, via []*Request) error
+	// MaxRedirects is the maximum number of redirects followed by Do,
+	// DefaultMaxRedirects if 0, a negative value disables the redirects
+	MaxRedirects int
+
+	// Jar stores the cookies received and sends them with the next
+	// requests, the cookies are ignored if nil
+	Jar *CookieJar
+
+	// TLSConfig is used for the https requests: RootCAs is the pool of
+	// the authorities trusted, the system pool if nil, and Certificates
+	// the certificates sent when the server asks for one (mutual TLS)
+	TLSConfig *tls.Config
+
+	mu        sync.Mutex
+	cond      *sync.Cond                // signaled when a connection is released
+	idle      map[string][]*persistConn // host -> idle connections, most recent last
+	idleCount int
+	conns     map[string]int // host -> open connections
+}
+
+// DefaultClient is the client used by Do
+var DefaultClient = &Client{}
+
+// persistConn is a connection of the client pool
+type persistConn struct {
+	conn   gonet.Conn // *net.Conn or *tls.Conn
+	tls    *tls.ConnectionState
+	cr     *connReader
+	key    string      // host of the connection
+	timer  *time.Timer // closes the connection once idle for too long
+	reused bool
+}
+
+func (c *Client) maxIdleConns() int {
+	if c.MaxIdleConns > 0 {
+		return c.MaxIdleConns
+	}
+	return DefaultMaxIdleConns
+}
+
+func (c *Client) maxIdleConnsPerHost() int {
+	if c.MaxIdleConnsPerHost > 0 {
+		return c.MaxIdleConnsPerHost
+	}
+	return DefaultMaxIdleConnsPerHost
+}
+
+func (c *Client) idleConnTimeout() time.Duration {
+	if c.IdleConnTimeout > 0 {
+		return c.IdleConnTimeout
+	}
+	return DefaultIdleConnTimeout
+}
+
+// connKey returns the key of the connections to the host of u
+func connKey(u *URL) string {
+	port := u.Port
+	if port == "" {
+		port = defaultPort(u)
+	}
+	return u.Scheme + "://" + (&URL{Host: u.Host, Port: port}).HostPort()
+}
+
+// init allocates the pool, c.mu must be held
+func (c *Client) init() {
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.mu)
+		c.idle = map[string][]*persistConn{}
+		c.conns = map[string]int{}
+	}
+}
+
+// getConn returns an idle connection to the host of u if there is one,
+// else a new connection
+func (c *Client) getConn(u *URL) (*persistConn, error) {
+	key := connKey(u)
+	c.mu.Lock()
+	c.init()
+	for {
+		if pc := c.popIdle(key); pc != nil {
+			c.mu.Unlock()
+			pc.reused = true
+			return pc, nil
+		}
+		if c.MaxConnsPerHost <= 0 || c.conns[key] < c.MaxConnsPerHost {
+			break
+		}
+		c.cond.Wait()
+	}
+	c.conns[key]++
+	c.mu.Unlock()
+
+	pc, err := c.dialConn(u)
+	if err != nil {
+		c.mu.Lock()
+		c.release(key)
+		c.mu.Unlock()
+		return nil, err
+	}
+	pc.key = key
+	return pc, nil
+}
+
+// tlsConfig returns the TLS configuration of a connection to host
+func (c *Client) tlsConfig(host string) *tls.Config {
+	var config *tls.Config
+	if c.TLSConfig == nil {
+		config = &tls.Config{}
+	} else {
+		config = c.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		// * The name is sent with SNI and checked against the certificate,
+		// an IP address is only checked - RFC 6066, 3
+		config.ServerName = host
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config
+}
+
+// dialConn opens a new connection to the host of u, the TLS handshake is
+// done for the https scheme
+func (c *Client) dialConn(u *URL) (*persistConn, error) {
+	conn, err := dial(u)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return &persistConn{conn: &conn, cr: newConnReader(&conn)}, nil
+	}
+	tlsConn := tls.Client(&conn, c.tlsConfig(u.Host))
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	return &persistConn{conn: tlsConn, tls: &state, cr: newConnReader(tlsConn)}, nil
+}
+
+// popIdle removes and returns the most recent idle connection to key,
+// c.mu must be held
+func (c *Client) popIdle(key string) *persistConn {
+	pconns := c.idle[key]
+	if len(pconns) == 0 {
+		return nil
+	}
+	pc := pconns[len(pconns)-1]
+	c.removeIdle(pc)
+	pc.timer.Stop()
+	return pc
+}
+
+// removeIdle removes pc from the idle connections, false if it is not
+// idle, c.mu must be held
+func (c *Client) removeIdle(pc *persistConn) bool {
+	pconns := c.idle[pc.key]
+	for i, idle := range pconns {
+		if idle == pc {
+			c.idle[pc.key] = append(pconns[:i], pconns[i+1:]...)
+			if len(c.idle[pc.key]) == 0 {
+				delete(c.idle, pc.key)
+			}
+			c.idleCount--
+			return true
+		}
+	}
+	return false
+}
+
+// release forgets a closed connection to key, c.mu must be held
+func (c *Client) release(key string) {
+	if c.conns[key]--; c.conns[key] <= 0 {
+		delete(c.conns, key)
+	}
+	c.cond.Broadcast()
+}
+
+// putIdle keeps pc open for the next requests, it is closed if the
+// limits of idle connections are reached
+func (c *Client) putIdle(pc *persistConn) {
+	c.mu.Lock()
+	if c.idleCount >= c.maxIdleConns() || len(c.idle[pc.key]) >= c.maxIdleConnsPerHost() {
+		c.mu.Unlock()
+		c.closeConn(pc)
+		return
+	}
+	c.idle[pc.key] = append(c.idle[pc.key], pc)
+	c.idleCount++
+	pc.timer = time.AfterFunc(c.idleConnTimeout(), func() { c.evict(pc) })
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// evict closes pc if it is still idle
+func (c *Client) evict(pc *persistConn) {
+	c.mu.Lock()
+	idle := c.removeIdle(pc)
+	c.mu.Unlock()
+	if idle {
+		c.closeConn(pc)
+	}
+}
+
+// closeConn closes pc and releases its place in the pool
+func (c *Client) closeConn(pc *persistConn) {
+	pc.conn.Close()
+	c.mu.Lock()
+	c.release(pc.key)
+	c.mu.Unlock()
+}
+
+// CloseIdleConnections closes the connections kept open by the client
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	var pconns []*persistConn
+	for _, idle := range c.idle {
+		pconns = append(pconns, idle...)
+	}
+	for _, pc := range pconns {
+		c.removeIdle(pc)
+		pc.timer.Stop()
+	}
+	c.mu.Unlock()
+	for _, pc := range pconns {
+		c.closeConn(pc)
+	}
+}
+
+// roundTrip sends req on the connection and returns the final response
+func (pc *persistConn) roundTrip(req *Request) (*Response, error) {
+	if _, err := pc.conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := readResponse(pc.cr, req)
+		if err != nil {
+			return nil, err
+		}
+		resp.TLS = pc.tls
+		// The interim responses are followed by the final one
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != StatusSwitchingProtocols {
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// reusable returns true if the connection can be used for the next
+// requests: the response has been fully read and neither the client nor
+// the server asked to close the connection
+func (pc *persistConn) reusable(req *Request, resp *Response) bool {
+	if resp.Close || req.Header.HasToken(Connection, "close") {
+		return false
+	}
+	if resp.StatusCode == StatusSwitchingProtocols {
+		return false
+	}
+	return len(pc.cr.buf) == 0
+}
+
+// idempotentMethod returns true if a request can be sent again without
+// side effects - RFC 7231, 4.2.2
+func idempotentMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// canRetry returns true if the request sent on a reused connection
+// failed because the server closed it while it was idle
+func canRetry(req *Request, pc *persistConn, err error) bool {
+	if !pc.reused || !idempotentMethod(req.Method) {
+		return false
+	}
+	// * The errors of a TLS connection wrap the errors of the socket
+	return errors.Is(err, io.EOF) || errors.Is(err, unix.EPIPE) || errors.Is(err, unix.ECONNRESET)
+}
+
+// send sends the request and returns the response received, the
+// connection is kept open for the next requests to the same host
+func (c *Client) send(req *Request) (*Response, error) {
+	for {
+		pc, err := c.getConn(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := pc.roundTrip(req)
+		if err != nil {
+			c.closeConn(pc)
+			if canRetry(req, pc, err) {
+				continue
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if pc.reusable(req, resp) {
+			c.putIdle(pc)
+		} else {
+			c.closeConn(pc)
+		}
+		return resp, nil
+	}
+}
+
+// ErrNotUpgraded is returned by Upgrade when the server has not switched
+// protocols, with its response
+var ErrNotUpgraded = errors.New("http: the server did not switch protocols")
+
+// Upgrade sends req, with the Upgrade and Connection headers set by the
+// caller, on a new connection and returns the connection once the server
+// has switched protocols with a 101 response, with the data received
+// after the response. The connection is not kept by the client and is
+// closed by the caller, it is not counted in MaxConnsPerHost and
+// Upgrade does not wait for the limit. Another response is returned with
+// ErrNotUpgraded.
+func (c *Client) Upgrade(req *Request) (*Response, gonet.Conn, []byte, error) {
+	if req.URL == nil {
+		return nil, nil, nil, errors.New("Missing request URL")
+	}
+	if req.Header == nil {
+		req.Header = Header{}
+	}
+	pc, err := c.dialConn(req.URL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	resp, err := pc.roundTrip(c.withCookies(req))
+	if err != nil {
+		pc.conn.Close()
+		return nil, nil, nil, err
+	}
+	if c.Jar != nil {
+		c.Jar.SetCookies(req.URL, resp.Cookies())
+	}
+	if resp.StatusCode != StatusSwitchingProtocols {
+		pc.conn.Close()
+		return resp, nil, nil, ErrNotUpgraded
+	}
+	return resp, pc.conn, pc.cr.takeBuffered(), nil
+}
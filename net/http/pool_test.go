@@ -0,0 +1,280 @@
+package http
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"../../net"
+	"golang.org/x/sys/unix"
+)
+
+// testServer serves router on a local port and counts the connections
+type testServer struct {
+	socket   net.TCPServer
+	accepted int32
+	url      string
+	loop     net.Loop // event loop serving the connections if any
+}
+
+// listenAddr returns a socket listening on a free port of addr and the port
+func listenAddr(tb testing.TB, addr string) (net.TCPServer, int) {
+	socket, err := net.DialAddr(addr, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err = socket.Listen(); err != nil {
+		tb.Fatal(err)
+	}
+	sa, err := unix.Getsockname(socket.Fd)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return socket, sa.Port
+	case *unix.SockaddrInet6:
+		return socket, sa.Port
+	}
+	tb.Fatalf("Getsockname: unexpected address %v", sa)
+	return socket, 0
+}
+
+// listenLocal returns a socket listening on a free local port and its url
+func listenLocal(tb testing.TB) (net.TCPServer, string) {
+	socket, port := listenAddr(tb, "127.0.0.1")
+	return socket, "http://127.0.0.1:" + strconv.Itoa(port)
+}
+
+func newTestServer(tb testing.TB, router *Router, config ServerConfig) *testServer {
+	socket, url := listenLocal(tb)
+	return serveTestSocket(socket, url, router, config)
+}
+
+// serveTestSocket serves router on a goroutine per connection accepted
+// by socket
+func serveTestSocket(socket net.TCPServer, url string, router *Router, config ServerConfig) *testServer {
+	ts := &testServer{socket: socket, url: url}
+	s := &server{socket: socket, router: router, config: config}
+	go func() {
+		for {
+			c, err := socket.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&ts.accepted, 1)
+			go s.serve(c)
+		}
+	}()
+	return ts
+}
+
+func (ts *testServer) Close() {
+	if ts.loop != nil {
+		ts.loop.Stop()
+		return
+	}
+	unix.Shutdown(ts.socket.Fd, unix.SHUT_RDWR)
+	unix.Close(ts.socket.Fd)
+}
+
+func newPoolRouter() *Router {
+	router := NewRouter()
+	router.GET("/hello", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("hello"))
+	})
+	router.GET("/close", func(w ResponseWriter, r *Request) {
+		w.Header().Set(Connection, "close")
+		w.Write([]byte("bye"))
+	})
+	router.GET("/slow", func(w ResponseWriter, r *Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("slow"))
+	})
+	return router
+}
+
+func get(t testing.TB, c *Client, url string) *Response {
+	req, err := NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(&req)
+	if err != nil {
+		t.Fatalf("Do %s: %v", url, err)
+	}
+	return resp
+}
+
+func TestClientReuse(t *testing.T) {
+	ts := newTestServer(t, newPoolRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	for i := 0; i < 3; i++ {
+		if resp := get(t, c, ts.url+"/hello"); string(resp.Body) != "hello" {
+			t.Errorf("Body: expect %q, has %q", "hello", resp.Body)
+		}
+	}
+	if n := atomic.LoadInt32(&ts.accepted); n != 1 {
+		t.Errorf("Connections: expect 1, has %d - Test type: \033[31m%s\033[0m", n, "Idle connection reused")
+	}
+	get(t, c, ts.url+"/close")
+	get(t, c, ts.url+"/hello")
+	if n := atomic.LoadInt32(&ts.accepted); n != 2 {
+		t.Errorf("Connections: expect 2, has %d - Test type: \033[31m%s\033[0m", n, "Connection: close honored")
+	}
+}
+
+func TestClientDualStack(t *testing.T) {
+	socket, port := listenAddr(t, "::")
+	ts := serveTestSocket(socket, "", newPoolRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	for _, host := range []string{"127.0.0.1", "[::1]", "[::ffff:127.0.0.1]"} {
+		url := "http://" + host + ":" + strconv.Itoa(port) + "/hello"
+		if resp := get(t, c, url); string(resp.Body) != "hello" {
+			t.Errorf("Body: expect %q, has %q - Test type: \033[31m%s\033[0m", "hello", resp.Body, url)
+		}
+	}
+	if n := atomic.LoadInt32(&ts.accepted); n != 3 {
+		t.Errorf("Connections: expect 3, has %d", n)
+	}
+}
+
+func TestListenAndServeErrors(t *testing.T) {
+	socket, port := listenAddr(t, "127.0.0.1")
+	defer unix.Close(socket.Fd)
+	for _, addr := range []string{"127.0.0.1", "127.0.0.1:99999", "[::1", "127.0.0.1:" + strconv.Itoa(port)} {
+		if err := ListenAndServe(addr, newPoolRouter()); err == nil {
+			t.Errorf("ListenAndServe(%s): expect an error", addr)
+		}
+	}
+}
+
+func TestClientServerClosedIdle(t *testing.T) {
+	ts := newTestServer(t, newPoolRouter(), ServerConfig{MaxRequestsPerConn: 1})
+	defer ts.Close()
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	// The server closes each connection after a request, its response
+	// says so and the connection is not kept
+	for i := 0; i < 2; i++ {
+		get(t, c, ts.url+"/hello")
+	}
+	c.mu.Lock()
+	idle := c.idleCount
+	c.mu.Unlock()
+	if idle != 0 {
+		t.Errorf("Idle connections: expect 0, has %d", idle)
+	}
+}
+
+func TestClientIdleEviction(t *testing.T) {
+	ts := newTestServer(t, newPoolRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{IdleConnTimeout: 20 * time.Millisecond}
+
+	get(t, c, ts.url+"/hello")
+	time.Sleep(100 * time.Millisecond)
+	c.mu.Lock()
+	idle, open := c.idleCount, len(c.conns)
+	c.mu.Unlock()
+	if idle != 0 || open != 0 {
+		t.Errorf("Pool: expect no connection, has %d idle and %d open", idle, open)
+	}
+	get(t, c, ts.url+"/hello")
+	if n := atomic.LoadInt32(&ts.accepted); n != 2 {
+		t.Errorf("Connections: expect 2, has %d", n)
+	}
+	c.CloseIdleConnections()
+}
+
+func TestClientLimits(t *testing.T) {
+	ts := newTestServer(t, newPoolRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{MaxConnsPerHost: 2, MaxIdleConnsPerHost: 1}
+	defer c.CloseIdleConnections()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(t, c, ts.url+"/slow")
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&ts.accepted); n > 6 || n < 2 {
+		t.Errorf("Connections: expect between 2 and 6, has %d", n)
+	}
+	c.mu.Lock()
+	idle, open := c.idleCount, c.conns[connKey(&URL{Scheme: "http", Host: "127.0.0.1", Port: ts.url[len("http://127.0.0.1:"):]})]
+	c.mu.Unlock()
+	if idle != 1 || open != 1 {
+		t.Errorf("Pool: expect 1 idle and 1 open connection, has %d and %d", idle, open)
+	}
+}
+
+func TestClientRetryStaleConn(t *testing.T) {
+	ts := newTestServer(t, newPoolRouter(), ServerConfig{IdleTimeout: 20 * time.Millisecond})
+	defer ts.Close()
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	get(t, c, ts.url+"/hello")
+	// The server closes the idle connection kept by the client
+	time.Sleep(100 * time.Millisecond)
+	if resp := get(t, c, ts.url+"/hello"); string(resp.Body) != "hello" {
+		t.Errorf("Body: expect %q, has %q", "hello", resp.Body)
+	}
+	if n := atomic.LoadInt32(&ts.accepted); n != 2 {
+		t.Errorf("Connections: expect 2, has %d", n)
+	}
+}
+
+func TestClientUpgrade(t *testing.T) {
+	ts := newTestServer(t, newHijackRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{}
+
+	req, _ := NewRequest("GET", ts.url+"/hijack", nil)
+	req.Header.Set(Upgrade, "echo")
+	req.Header.Set(Connection, "Upgrade")
+	resp, conn, buffered, err := c.Upgrade(&req)
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	defer conn.Close()
+	if resp.StatusCode != StatusSwitchingProtocols || resp.Header.Get(Upgrade) != "echo" {
+		t.Errorf("Response: expect 101 with Upgrade: echo, has %s %q", resp.Status, resp.Header.Get(Upgrade))
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	conn.Write([]byte("ping"))
+	has := string(buffered)
+	buf := make([]byte, 16)
+	for len(has) < len("ping") {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		has += string(buf[:n])
+	}
+	if has != "ping" {
+		t.Errorf("Echo: expect %q, has %q", "ping", has)
+	}
+
+	req, _ = NewRequest("GET", ts.url+"/hello", nil)
+	resp, conn, _, err = c.Upgrade(&req)
+	if err != ErrNotUpgraded || conn != nil {
+		t.Errorf("Upgrade: expect %v, has %v", ErrNotUpgraded, err)
+	} else if string(resp.Body) != "hello" {
+		t.Errorf("Body: expect %q, has %q", "hello", resp.Body)
+	}
+}
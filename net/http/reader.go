@@ -0,0 +1,305 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"../../net"
+)
+
+const (
+	// DefaultMaxHeaderBytes is the maximum size of the request line and headers
+	DefaultMaxHeaderBytes = 1 << 20 // 1 MB
+	// DefaultMaxBodyBytes is the maximum size of a request body
+	DefaultMaxBodyBytes = 10 << 20 // 10 MB
+
+	readChunkSize = 4096
+)
+
+// statusError is an error met while reading a request which must be
+// answered with a given status code
+type statusError struct {
+	code int
+	text string
+}
+
+func (e statusError) Error() string { return e.text }
+
+// errReadTimeout is returned when a request has not been received from a
+// connection during the idle timeout
+var errReadTimeout = net.ErrTimeout
+
+var (
+	errHeaderTooLarge    = statusError{StatusRequestHeaderFieldsTooLarge, "Request header fields too large"}
+	errBodyTooLarge      = statusError{StatusRequestEntityTooLarge, "Request entity too large"}
+	errInvalidContentLen = statusError{StatusBadRequest, "Invalid Content-Length"}
+	errLineTooLong       = statusError{StatusBadRequest, "Line too long"}
+	errBadRequestLine    = statusError{StatusBadRequest, "Invalid request line"}
+	errBadMultipart      = statusError{StatusBadRequest, "Invalid multipart form"}
+)
+
+// connReader buffers the data received from a connection so that a message
+// can be read incrementally: first the headers until the "\r\n\r\n"
+// delimiter, then exactly the number of bytes of the body.
+// The data received after a message stays in the buffer for the next one.
+type connReader struct {
+	src      io.Reader
+	buf      []byte // received data not consumed yet
+	scratch  []byte
+	deadline time.Time     // time by which the headers must be received
+	timeout  time.Duration // maximum wait of each read of the body
+}
+
+func newConnReader(src io.Reader) *connReader {
+	return &connReader{
+		src:     src,
+		scratch: make([]byte, readChunkSize),
+	}
+}
+
+// takeBuffered returns the data received and not consumed, the reader
+// forgets it
+func (cr *connReader) takeBuffered() []byte {
+	buf := cr.buf
+	cr.buf = nil
+	return buf
+}
+
+// setDeadline sets the time by which the start line and the headers of
+// the next message must be received, the data trickling in does not push
+// it back. The body is then read with timeout between two reads, a body
+// received slowly but steadily is not cut off. Zero values mean no limit.
+func (cr *connReader) setDeadline(t time.Time, timeout time.Duration) error {
+	cr.deadline, cr.timeout = t, timeout
+	return cr.setReadDeadline(t)
+}
+
+// setReadDeadline sets the deadline of the source if it supports one
+func (cr *connReader) setReadDeadline(t time.Time) error {
+	if conn, ok := cr.src.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return conn.SetReadDeadline(t)
+	}
+	return nil
+}
+
+// fill reads the next available data from the source into the buffer
+func (cr *connReader) fill() error {
+	if !cr.deadline.IsZero() {
+		if !time.Now().Before(cr.deadline) {
+			return errReadTimeout
+		}
+	} else if cr.timeout > 0 {
+		if err := cr.setReadDeadline(time.Now().Add(cr.timeout)); err != nil {
+			return err
+		}
+	}
+	n, err := cr.src.Read(cr.scratch)
+	if n > 0 {
+		cr.buf = append(cr.buf, cr.scratch[:n]...)
+		return nil
+	}
+	if err == nil {
+		return io.ErrNoProgress
+	}
+	return err
+}
+
+// wait returns once data is buffered, it reads the source if there is none
+func (cr *connReader) wait() error {
+	if len(cr.buf) != 0 {
+		return nil
+	}
+	return cr.fill()
+}
+
+// readHeader returns the start line and the headers of a message, without
+// the final delimiter, once they have been fully received.
+// io.EOF is returned if the connection is closed before any data.
+func (cr *connReader) readHeader(max int) (string, error) {
+	const delimiter = "\r\n\r\n"
+	var searchFrom int
+
+	for {
+		// Ignore the empty lines received before the start line - RFC 7230, 3.5
+		for bytes.HasPrefix(cr.buf, []byte("\r\n")) {
+			cr.buf = cr.buf[2:]
+		}
+		if i := bytes.Index(cr.buf[searchFrom:], []byte(delimiter)); i != -1 {
+			end := searchFrom + i
+			if end > max {
+				return "", errHeaderTooLarge
+			}
+			header := string(cr.buf[:end])
+			cr.buf = cr.buf[end+len(delimiter):]
+			// The body is read with the timeout between reads
+			cr.deadline = time.Time{}
+			return header, nil
+		}
+		if len(cr.buf) > max {
+			return "", errHeaderTooLarge
+		}
+		// The delimiter can be split between two reads
+		if searchFrom = len(cr.buf) - len(delimiter) + 1; searchFrom < 0 {
+			searchFrom = 0
+		}
+		if err := cr.fill(); err != nil {
+			if err == io.EOF && len(cr.buf) != 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+}
+
+// Read reads the buffered data first, then from the source
+func (cr *connReader) Read(p []byte) (int, error) {
+	if len(cr.buf) == 0 {
+		if err := cr.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// readLine returns the next line received without the "\r\n" delimiter
+func (cr *connReader) readLine(max int) (string, error) {
+	var searchFrom int
+
+	for {
+		if i := bytes.Index(cr.buf[searchFrom:], []byte("\r\n")); i != -1 {
+			end := searchFrom + i
+			line := string(cr.buf[:end])
+			cr.buf = cr.buf[end+2:]
+			return line, nil
+		}
+		if len(cr.buf) > max {
+			return "", errLineTooLong
+		}
+		if searchFrom = len(cr.buf) - 1; searchFrom < 0 {
+			searchFrom = 0
+		}
+		if err := cr.fill(); err != nil {
+			if err == io.EOF {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+}
+
+// readAll returns the data received until the connection is closed
+func (cr *connReader) readAll(max int64) ([]byte, error) {
+	for {
+		if int64(len(cr.buf)) > max {
+			return nil, errBodyTooLarge
+		}
+		if err := cr.fill(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	data := cr.buf
+	cr.buf = nil
+	return data, nil
+}
+
+// readFull returns the next n bytes received
+func (cr *connReader) readFull(n int64) ([]byte, error) {
+	for int64(len(cr.buf)) < n {
+		if err := cr.fill(); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	data := make([]byte, n)
+	copy(data, cr.buf[:n])
+	cr.buf = cr.buf[n:]
+	return data, nil
+}
+
+// readRequest reads and parses the next request received on the connection
+func readRequest(cr *connReader, config ServerConfig) (*Request, error) {
+	header, err := cr.readHeader(config.maxHeaderBytes())
+	if err != nil {
+		return nil, err
+	}
+	r := InitRequest()
+	r.parseHeaders(header)
+	if r.Method == "" || r.URL == nil || r.Proto == "" {
+		return nil, errBadRequestLine
+	}
+	if r.HasPostForm && len(r.Header.Values(TransferEncoding)) == 0 {
+		return r, readMultipartBody(cr, r, config)
+	}
+	body, err := readBody(cr, r, config)
+	if err != nil {
+		return nil, err
+	}
+	r.parseBody(string(body), config.maxMemory())
+	return r, nil
+}
+
+// readMultipartBody parses a multipart/form-data body as it is received
+// without keeping it in memory, the files beyond the maximum memory are
+// stored in temporary files
+func readMultipartBody(cr *connReader, r *Request, config ServerConfig) error {
+	if r.ContentLength < 0 {
+		return errInvalidContentLen
+	}
+	if r.ContentLength > config.maxBodyBytes() {
+		return errBodyTooLarge
+	}
+	body := io.LimitReader(cr, r.ContentLength)
+	err := r.readMultipartForm(body, config.maxMemory())
+	// The epilogue is ignored
+	if _, drainErr := io.Copy(ioutil.Discard, body); err == nil {
+		err = drainErr
+	}
+	if err != nil && r.MultipartForm != nil {
+		// No handler receives the files, they are removed now
+		r.MultipartForm.RemoveAll()
+		r.MultipartForm = nil
+	}
+	if err == errMalformedMultipart || err == errMultipartTooLarge || err == io.ErrUnexpectedEOF {
+		return errBadMultipart
+	}
+	return err
+}
+
+// readBody reads the body of r, its length is given by the Transfer-Encoding
+// header if any, else by the Content-Length header
+func readBody(cr *connReader, r *Request, config ServerConfig) ([]byte, error) {
+	if r.ContentLength < 0 {
+		return nil, errInvalidContentLen
+	}
+	if codings := r.Header.List(TransferEncoding); len(codings) != 0 {
+		// chunked is the only supported coding and must be applied once
+		for _, coding := range codings {
+			if !strings.EqualFold(coding, "chunked") {
+				return nil, errUnsupportedEncoding
+			}
+		}
+		if len(codings) > 1 {
+			return nil, errMalformedChunk
+		}
+		body, trailer, err := cr.readChunked(config.maxBodyBytes(), config.maxHeaderBytes())
+		if err != nil {
+			return nil, err
+		}
+		r.Trailer = trailer
+		r.ContentLength = int64(len(body))
+		return body, nil
+	}
+	if r.ContentLength > config.maxBodyBytes() {
+		return nil, errBodyTooLarge
+	}
+	return cr.readFull(r.ContentLength)
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var readRequestTests = []struct {
+	raw         string       // input
+	config      ServerConfig // server limits
+	url         string       // expected URL
+	body        string       // expected body
+	err         error        // expected error
+	testContent string       // test details
+}{
+	{
+		"GET /bonjour HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		ServerConfig{}, "/bonjour", "", nil, "No body",
+	},
+	{
+		"\r\nPOST /form HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world",
+		ServerConfig{}, "/form", "hello world", nil, "Leading empty line and body",
+	},
+	{
+		"GET /" + strings.Repeat("a", 2000) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		ServerConfig{}, "/" + strings.Repeat("a", 2000), "", nil, "Request line larger than 1KB",
+	},
+	{
+		"POST /big HTTP/1.1\r\nContent-Length: 5000\r\n\r\n" + strings.Repeat("b", 5000),
+		ServerConfig{}, "/big", strings.Repeat("b", 5000), nil, "Body larger than 1KB",
+	},
+	{
+		"GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("c", 100) + "\r\n\r\n",
+		ServerConfig{MaxHeaderBytes: 64}, "", "", errHeaderTooLarge, "Headers too large",
+	},
+	{
+		"GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("c", 100),
+		ServerConfig{MaxHeaderBytes: 64}, "", "", errHeaderTooLarge, "Headers too large without delimiter",
+	},
+	{
+		"POST / HTTP/1.1\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("d", 100),
+		ServerConfig{MaxBodyBytes: 10}, "", "", errBodyTooLarge, "Body too large",
+	},
+	{
+		"POST / HTTP/1.1\r\nContent-Length: -4\r\n\r\n",
+		ServerConfig{}, "", "", errInvalidContentLen, "Negative Content-Length",
+	},
+	{
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\ncontent-length: 5\r\n\r\nhello",
+		ServerConfig{}, "/", "hello", nil, "Repeated Content-Length",
+	},
+	{
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\ncontent-length: 3\r\n\r\nhello",
+		ServerConfig{}, "", "", errInvalidContentLen, "Conflicting Content-Length",
+	},
+	{
+		"POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nshort",
+		ServerConfig{}, "", "", io.ErrUnexpectedEOF, "Truncated body",
+	},
+	{
+		"GET / HTTP/1.1\r\nHost: loc",
+		ServerConfig{}, "", "", io.ErrUnexpectedEOF, "Truncated headers",
+	},
+	{
+		"GET /a%zz HTTP/1.1\r\n\r\n",
+		ServerConfig{}, "", "", errBadRequestLine, "Invalid URL escape",
+	},
+	{
+		"",
+		ServerConfig{}, "", "", io.EOF, "Closed connection",
+	},
+}
+
+func TestReadRequest(t *testing.T) {
+	for _, tt := range readRequestTests {
+		// Deliver the data byte by byte to check the incremental reading
+		cr := newConnReader(iotest.OneByteReader(strings.NewReader(tt.raw)))
+		r, err := readRequest(cr, tt.config)
+		if err != tt.err {
+			t.Errorf("readRequest: expect error %v, has %v - Test type: \033[31m%s\033[0m",
+				tt.err, err, tt.testContent)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if r.RequestURI != tt.url || string(r.Body) != tt.body {
+			t.Errorf("readRequest: expect [%s] [%s], has [%s] [%s] - Test type: \033[31m%s\033[0m",
+				tt.url, tt.body, r.RequestURI, r.Body, tt.testContent)
+		}
+	}
+}
+
+func TestReadRequestPipelined(t *testing.T) {
+	cr := newConnReader(strings.NewReader(
+		"POST /a HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcGET /b HTTP/1.1\r\n\r\n",
+	))
+	for _, url := range []string{"/a", "/b"} {
+		r, err := readRequest(cr, ServerConfig{})
+		if err != nil {
+			t.Fatalf("readRequest(%s): %v", url, err)
+		}
+		if r.RequestURI != url {
+			t.Errorf("readRequest: expect %s, has %s", url, r.RequestURI)
+		}
+	}
+	if _, err := readRequest(cr, ServerConfig{}); err != io.EOF {
+		t.Errorf("readRequest: expect EOF, has %v", err)
+	}
+}
+
+func TestReadRequestFramingCase(t *testing.T) {
+	tests := []struct {
+		raw         string // two pipelined requests
+		testContent string // test details
+	}{
+		{"POST /a HTTP/1.1\r\nhost: x\r\ncontent-length: 5\r\n\r\nhelloGET /b HTTP/1.1\r\nhost: x\r\n\r\n", "Lower case"},
+		{"POST /a HTTP/1.1\r\nHOST: x\r\nCONTENT-LENGTH: 5\r\n\r\nhelloGET /b HTTP/1.1\r\nHOST: x\r\n\r\n", "Upper case"},
+		{"POST /a HTTP/1.1\r\nhOsT: x\r\ncontent-Length: 5\r\n\r\nhelloGET /b HTTP/1.1\r\nhOsT: x\r\n\r\n", "Mixed case"},
+		{"POST /a HTTP/1.1\r\nhost: x\r\ntransfer-encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\nGET /b HTTP/1.1\r\nhost: x\r\n\r\n", "Chunked"},
+	}
+	for _, tt := range tests {
+		cr := newConnReader(iotest.OneByteReader(strings.NewReader(tt.raw)))
+		data := []byte(tt.raw)
+		for _, expect := range []struct{ url, body string }{{"/a", "hello"}, {"/b", ""}} {
+			r, err := readRequest(cr, ServerConfig{})
+			if err != nil {
+				t.Errorf("readRequest: expect no error, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+				break
+			}
+			if r.RequestURI != expect.url || r.Host != "x" || string(r.Body) != expect.body {
+				t.Errorf("readRequest: expect [%s] [x] [%s], has [%s] [%s] [%s] - Test type: \033[31m%s\033[0m",
+					expect.url, expect.body, r.RequestURI, r.Host, r.Body, tt.testContent)
+			}
+			// The requests buffered by an event loop are framed the same way
+			r, n, err := (&loopConnState{}).parseBuffered(data, ServerConfig{})
+			if err != nil {
+				t.Errorf("parseBuffered: expect no error, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+				break
+			}
+			if r.RequestURI != expect.url || string(r.Body) != expect.body {
+				t.Errorf("parseBuffered: expect [%s] [%s], has [%s] [%s] - Test type: \033[31m%s\033[0m",
+					expect.url, expect.body, r.RequestURI, r.Body, tt.testContent)
+			}
+			data = data[n:]
+		}
+	}
+}
+
+var readChunkedTests = []struct {
+	raw         string // input
+	body        string // expected body
+	trailer     Header // expected trailer
+	err         error  // expected error
+	testContent string // test details
+}{
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n",
+		"hello world", nil, nil, "Two chunks",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nA;name=value\r\n0123456789\r\n0\r\n\r\n",
+		"0123456789", nil, nil, "Chunk extension",
+	},
+	{
+		"POST / HTTP/1.1\r\ntransfer-encoding: chunked\r\ncontent-length: 3\r\n\r\n3\r\nabc\r\n0\r\n\r\n",
+		"", nil, errInvalidContentLen, "Content-Length with Transfer-Encoding",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\nExpires: never\r\nX-Sum: 42\r\n\r\n",
+		"abc", Header{"Expires": {"never"}, "X-Sum": {"42"}}, nil, "Trailer fields",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nabc\r\n0\r\n\r\n",
+		"", nil, errMalformedChunk, "Invalid chunk size",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n-3\r\nabc\r\n0\r\n\r\n",
+		"", nil, errMalformedChunk, "Negative chunk size",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nFFFFFFFFFFFFFFFF\r\nabc\r\n0\r\n\r\n",
+		"", nil, errMalformedChunk, "Overflowing chunk size",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nabc\r\n0\r\n\r\n",
+		"", nil, errMalformedChunk, "Chunk data longer than its size",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n",
+		"", nil, errUnsupportedEncoding, "Unsupported coding",
+	},
+	{
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n",
+		"", nil, io.ErrUnexpectedEOF, "Missing last chunk",
+	},
+}
+
+func TestReadRequestChunked(t *testing.T) {
+	for _, tt := range readChunkedTests {
+		cr := newConnReader(iotest.OneByteReader(strings.NewReader(tt.raw)))
+		r, err := readRequest(cr, ServerConfig{})
+		if err != tt.err {
+			t.Errorf("readRequest: expect error %v, has %v - Test type: \033[31m%s\033[0m",
+				tt.err, err, tt.testContent)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if string(r.Body) != tt.body || r.ContentLength != int64(len(tt.body)) {
+			t.Errorf("readRequest: expect body [%s], has [%s] - Test type: \033[31m%s\033[0m",
+				tt.body, r.Body, tt.testContent)
+		}
+		if diff := pretty.Compare(r.Trailer, tt.trailer); diff != "" {
+			t.Errorf("readRequest: trailer %s - Test type: \033[31m%s\033[0m", diff, tt.testContent)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Redirections - RFC 7231, 6.4
+
+// DefaultMaxRedirects is the maximum number of redirects followed by a
+// client
+const DefaultMaxRedirects = 10
+
+// ErrUseLastResponse can be returned by Client.CheckRedirect to stop
+// following the redirects, Do returns the last response without error
+var ErrUseLastResponse = errors.New("http: use last response")
+
+func (c *Client) maxRedirects() int {
+	if c.MaxRedirects != 0 {
+		return c.MaxRedirects
+	}
+	return DefaultMaxRedirects
+}
+
+// redirectBehavior returns the method and whether the body of the
+// request following a redirect response are kept, ok is false if the
+// response is not a redirect to follow
+func redirectBehavior(method string, status int) (next string, keepBody, ok bool) {
+	switch status {
+	case StatusMovedPermanently, StatusFound:
+		// Historically user agents change POST to GET - RFC 7231, 6.4.2
+		if method == "POST" {
+			return "GET", false, true
+		}
+		return method, true, true
+	case StatusSeeOther:
+		if method == "HEAD" {
+			return method, false, true
+		}
+		return "GET", false, true
+	case StatusTemporaryRedirect, StatusPermanentRedirect:
+		return method, true, true
+	}
+	return "", false, false
+}
+
+// newRedirectRequest returns the request to send to the location u
+// following the response to req
+func newRedirectRequest(req *Request, u *URL, method string, keepBody bool) *Request {
+	next := &Request{
+		Method:     method,
+		URL:        u,
+		RequestURI: u.RequestURI(),
+		Host:       u.HostPort(),
+
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+
+		Header: req.Header.clone(),
+	}
+	if keepBody {
+		next.Body = req.Body
+		next.ContentLength = req.ContentLength
+	} else {
+		next.Header.Del(ContentType)
+		next.Header.Del(ContentLength)
+	}
+	// The credentials are only sent to the host they are intended for
+	if connKey(u) != connKey(req.URL) {
+		next.Header.Del(Authorization)
+		next.Header.Del(CookieHeader)
+	}
+	return next
+}
+
+// withCookies returns a copy of req with the cookies of the jar of the
+// client, req if the client has no jar
+func (c *Client) withCookies(req *Request) *Request {
+	if c.Jar == nil {
+		return req
+	}
+	cookies := c.Jar.Cookies(req.URL)
+	if len(cookies) == 0 {
+		return req
+	}
+	r := *req
+	r.Header = req.Header.clone()
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return &r
+}
+
+// Do sends the request and returns the response received, the
+// connection is kept open for the next requests to the same host.
+// The redirects are followed, the responses of the redirects are stored
+// in Response.Redirects and Response.Request is the last request sent.
+func (c *Client) Do(req *Request) (*Response, error) {
+	if req.URL == nil {
+		return nil, errors.New("Missing request URL")
+	}
+	if req.Header == nil {
+		req.Header = Header{}
+	}
+	var via []*Request
+	var redirects []*Response
+	for {
+		resp, err := c.send(c.withCookies(req))
+		if err != nil {
+			return nil, err
+		}
+		resp.Redirects = redirects
+		if c.Jar != nil {
+			c.Jar.SetCookies(req.URL, resp.Cookies())
+		}
+
+		method, keepBody, ok := redirectBehavior(req.Method, resp.StatusCode)
+		location := resp.Header.Get(Location)
+		if !ok || location == "" || c.maxRedirects() < 0 {
+			return resp, nil
+		}
+		u, err := req.URL.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redirect location %q: %s", location, err.Error())
+		}
+		// The fragment of the request is kept - RFC 7231, 7.1.2
+		if u.Fragment == "" {
+			u.Fragment = req.URL.Fragment
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("Unsupported redirect scheme %q", u.Scheme)
+		}
+
+		via = append(via, req)
+		next := newRedirectRequest(req, u, method, keepBody)
+		if len(via) > c.maxRedirects() {
+			return nil, fmt.Errorf("Stopped after %d redirects", c.maxRedirects())
+		}
+		if c.CheckRedirect != nil {
+			if err := c.CheckRedirect(next, via); err != nil {
+				if err == ErrUseLastResponse {
+					return resp, nil
+				}
+				return nil, err
+			}
+		}
+		redirects = append(redirects, resp)
+		req = next
+	}
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func newRedirectRouter() *Router {
+	router := NewRouter()
+	for _, code := range []int{301, 302, 303, 307, 308} {
+		code := code
+		router.AddRoute("/"+strconv.Itoa(code), func(w ResponseWriter, r *Request) {
+			w.Header().Set(Location, "/target?from="+strconv.Itoa(code))
+			w.WriteHeader(code)
+		})
+	}
+	router.AddRoute("/relative/a", func(w ResponseWriter, r *Request) {
+		w.Header().Set(Location, "../target")
+		w.WriteHeader(StatusFound)
+	})
+	router.AddRoute("/chain", func(w ResponseWriter, r *Request) {
+		w.Header().Set(Location, "/301")
+		w.WriteHeader(StatusFound)
+	})
+	router.AddRoute("/loop", func(w ResponseWriter, r *Request) {
+		w.Header().Set(Location, "/loop")
+		w.WriteHeader(StatusFound)
+	})
+	router.AddRoute("/target", func(w ResponseWriter, r *Request) {
+		w.Write([]byte(r.Method + " " + r.URL.RawQuery + " " + string(r.Body)))
+	})
+	return router
+}
+
+var redirectTests = []struct {
+	method      string // method of the first request
+	path        string // path of the first request
+	expected    string // expected body of the final response
+	redirects   int    // expected number of redirects
+	testContent string // test details
+}{
+	{"GET", "/301", "GET from=301 ", 1, "301 GET"},
+	{"POST", "/301", "GET from=301 ", 1, "301 POST becomes GET"},
+	{"POST", "/302", "GET from=302 ", 1, "302 POST becomes GET"},
+	{"PUT", "/302", "PUT from=302 data", 1, "302 PUT kept"},
+	{"PUT", "/303", "GET from=303 ", 1, "303 always GET"},
+	{"POST", "/307", "POST from=307 data", 1, "307 method and body kept"},
+	{"POST", "/308", "POST from=308 data", 1, "308 method and body kept"},
+	{"GET", "/relative/a", "GET  ", 1, "Relative location"},
+	{"GET", "/chain", "GET from=301 ", 2, "Redirect chain"},
+}
+
+func TestClientRedirect(t *testing.T) {
+	ts := newTestServer(t, newRedirectRouter(), ServerConfig{})
+	defer ts.Close()
+	c := &Client{}
+	defer c.CloseIdleConnections()
+
+	for _, tt := range redirectTests {
+		body := []byte("data")
+		if tt.method == "GET" {
+			body = nil
+		}
+		req, _ := NewRequest(tt.method, ts.url+tt.path, body)
+		resp, err := c.Do(&req)
+		if err != nil {
+			t.Errorf("Do: unexpected error %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			continue
+		}
+		if string(resp.Body) != tt.expected {
+			t.Errorf("Body: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.expected, resp.Body, tt.testContent)
+		}
+		if len(resp.Redirects) != tt.redirects {
+			t.Errorf("Redirects: expect %d, has %d - Test type: \033[31m%s\033[0m", tt.redirects, len(resp.Redirects), tt.testContent)
+		}
+		if resp.Request.URL.Path != "/target" {
+			t.Errorf("Request: expect /target, has %s - Test type: \033[31m%s\033[0m", resp.Request.URL.Path, tt.testContent)
+		}
+	}
+}
+
+func TestClientRedirectLimits(t *testing.T) {
+	ts := newTestServer(t, newRedirectRouter(), ServerConfig{})
+	defer ts.Close()
+
+	c := &Client{MaxRedirects: 3}
+	defer c.CloseIdleConnections()
+	req, _ := NewRequest("GET", ts.url+"/loop", nil)
+	if _, err := c.Do(&req); err == nil {
+		t.Errorf("Do: expect an error after 3 redirects")
+	}
+
+	c.MaxRedirects = -1
+	if resp, err := c.Do(&req); err != nil || resp.StatusCode != StatusFound {
+		t.Errorf("Do: expect the redirect response, has %v %v", resp, err)
+	}
+
+	var via []*Request
+	c.MaxRedirects = 0
+	c.CheckRedirect = func(next *Request, previous []*Request) error {
+		via = previous
+		if len(previous) == 2 {
+			return ErrUseLastResponse
+		}
+		return nil
+	}
+	req, _ = NewRequest("GET", ts.url+"/chain", nil)
+	resp, err := c.Do(&req)
+	if err != nil || resp.StatusCode != StatusMovedPermanently || len(resp.Redirects) != 1 {
+		t.Errorf("Do: expect the second redirect response, has %v %v", resp, err)
+	}
+	if len(via) != 2 || via[0].URL.Path != "/chain" || via[1].URL.Path != "/301" {
+		t.Errorf("CheckRedirect: unexpected previous requests %v", via)
+	}
+
+	stop := errors.New("stop")
+	c.CheckRedirect = func(next *Request, previous []*Request) error { return stop }
+	if _, err := c.Do(&req); err != stop {
+		t.Errorf("Do: expect %v, has %v", stop, err)
+	}
+}
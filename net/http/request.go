@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"strconv"
 	"strings"
@@ -20,41 +21,15 @@ var (
 		"DELETE",
 		"TRACE",
 		"CONNECT",
+		"PATCH", // RFC 5789
 	}
 )
 
-// URL Living Standard - https://url.spec.whatwg.org/#urlencoded-parsing
-
-// Header allows to store headers
-type Header map[string][]string
-
-func (h *Header) AddHeader(key string, value string) {
-	(*h)[key] = append((*h)[key], value)
-}
-
-func (h *Header) AddHeaders(key string, values []string) {
-	for _, value := range values {
-		h.AddHeader(key, strings.TrimSpace(value))
-	}
-}
-
-// IsSet return true if the key has at least a value
-func (h Header) IsSet(key string) bool {
-	return len(h[key]) != 0
-}
-
-// Values store the URL values from thes forms
-type Values map[string][]string
-
-// AddValue append a new item to a given key in Values
-func (v *Values) AddValue(key, value string) {
-	(*v)[key] = append((*v)[key], value)
-}
-
 // Request is the structure where the request extracted data is stored
 type Request struct {
-	Method string
-	URL    string
+	Method     string
+	URL        *URL
+	RequestURI string // Request target as sent in the request line
 
 	Proto      string // "HTTP/1.0"
 	ProtoMajor int    // 1
@@ -64,6 +39,9 @@ type Request struct {
 
 	Body []byte
 
+	// Trailer stores the headers sent after a chunked body
+	Trailer Header
+
 	ContentLength int64
 
 	Host string
@@ -73,7 +51,17 @@ type Request struct {
 	PostForm    Values
 	HasPostForm bool
 
+	// MultipartForm stores the values and the files of a
+	// multipart/form-data body
+	MultipartForm *MultipartForm
+
 	ParsingError []string
+
+	// TLS describes the TLS connection the request was received on, nil
+	// for a cleartext connection
+	TLS *tls.ConnectionState
+
+	params []Param // url parameters of the route
 }
 
 // InitRequest init a new request structure
@@ -89,25 +77,39 @@ func InitRequest() *Request {
 func (r *Request) Bytes() []byte {
 	var buf bytes.Buffer
 
-	buf.WriteString(r.Method + " " + r.URL + " " + r.Proto + "\r\n")
+	buf.WriteString(r.Method + " " + r.URL.RequestURI() + " " + r.Proto + "\r\n")
 	buf.WriteString("Host: " + r.Host + "\r\n")
-	buf.WriteString("User-Agent: Go\r\n")
-	buf.WriteString("Accept: */*\r\n")
-	for key, values := range r.Header {
-		buf.WriteString(key + ": ")
-		for i, value := range values {
-			buf.WriteString(value + ",")
-			if i < len(values)-1 {
-				buf.WriteString(value + ",")
-			}
-		}
-		buf.WriteString("\r\n")
+	if !r.Header.IsSet(string(UserAgent)) {
+		buf.WriteString("User-Agent: Go\r\n")
+	}
+	if !r.Header.IsSet("Accept") {
+		buf.WriteString("Accept: */*\r\n")
 	}
-	buf.WriteString(string(ContentLength) + ": " + strconv.Itoa(len(r.Body)) + "\r\n\r\n")
+	r.Header.write(&buf, Host, ContentLength, TransferEncoding)
+	if len(r.Body) != 0 || r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" {
+		buf.WriteString(string(ContentLength) + ": " + strconv.Itoa(len(r.Body)) + "\r\n")
+	}
+	buf.WriteString("\r\n")
 	buf.Write(r.Body)
 	return buf.Bytes()
 }
 
+// Query returns the values of the URL query
+func (r *Request) Query() Values {
+	return r.URL.Query()
+}
+
+// Param returns the value of the url parameter name of the route
+// responding to the request, "" if there is none
+func (r *Request) Param(name string) string {
+	for _, p := range r.params {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
 // > GET /books/v1/volumes?q=isbn:0747532699 HTTP/2
 // > Host: www.googleapis.com
 // > User-Agent: curl/7.54.0
@@ -118,6 +120,25 @@ func (r *Request) Print() {
 	pretty.Print(r)
 }
 
+// protoAtLeast returns true if the HTTP version of the request is at
+// least major.minor
+func (r *Request) protoAtLeast(major, minor int) bool {
+	return r.ProtoMajor > major || (r.ProtoMajor == major && r.ProtoMinor >= minor)
+}
+
+// keepAlive returns true if the client wants to keep the connection open
+// after the response. It is the default from HTTP/1.1 unless
+// "Connection: close" is sent, before it requires "Connection: keep-alive".
+func (r *Request) keepAlive() bool {
+	if r.Header.HasToken(Connection, "close") {
+		return false
+	}
+	if r.protoAtLeast(1, 1) {
+		return true
+	}
+	return r.Header.HasToken(Connection, "keep-alive")
+}
+
 func (r *Request) pushError(err string) {
 	r.ParsingError = append(r.ParsingError, err)
 }
@@ -160,9 +181,19 @@ func parseHTTPVersion(value string) (major, minor int, ok bool) {
 	return major, minor, true
 }
 
+// parseHeaderField splits a header line in its name and its value
+// header-field = field-name ":" OWS field-value OWS
+func parseHeaderField(line string) (string, string, bool) {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 || strings.ContainsAny(line[:i], " \t") {
+		return "", "", false
+	}
+	return line[:i], strings.TrimSpace(line[i+1:]), true
+}
+
 func (r *Request) parseHeaders(headers string) {
 	array := strings.Split(headers, "\r\n")
-	var ok, requestSpecCollected bool
+	var ok, requestSpecCollected, contentLengthSet bool
 
 	for _, header := range array {
 		if !requestSpecCollected {
@@ -176,7 +207,13 @@ func (r *Request) parseHeaders(headers string) {
 			} else {
 				r.Method = request[0]
 			}
-			r.URL = request[1]
+			r.RequestURI = request[1]
+			u, err := ParseURL(request[1])
+			if err != nil {
+				r.pushError(request[1] + " is not a valid URL: " + err.Error())
+			} else {
+				r.URL = u
+			}
 			r.ProtoMajor, r.ProtoMinor, ok = parseHTTPVersion(request[2])
 			if !ok {
 				r.pushError(request[2] + " is not a valid HTTP version")
@@ -185,126 +222,76 @@ func (r *Request) parseHeaders(headers string) {
 			}
 			requestSpecCollected = true
 		} else {
-			h := strings.Split(header, ": ")
-			if len(h) != 2 {
+			key, value, ok := parseHeaderField(header)
+			if !ok {
 				r.pushError("Invalid header format")
 				continue
 			}
-			if h[0] == string(ContentLength) {
-				value, err := strconv.Atoi(h[1])
-				if err == nil {
-					r.ContentLength = int64(value)
+			// * The framing headers are compared case-insensitively, a
+			// mismatch would desynchronize the pipelined requests
+			switch headerName(CanonicalHeaderKey(key)) {
+			case ContentLength:
+				length, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || length < 0 {
+					r.pushError(value + " is not a valid Content-Length")
+					length = -1
+				}
+				if contentLengthSet && length != r.ContentLength {
+					r.pushError("Conflicting Content-Length values")
+					length = -1
 				}
+				if r.ContentLength >= 0 {
+					r.ContentLength = length
+				}
+				contentLengthSet = true
 				continue
-			}
-			if h[0] == string(Host) {
-				r.Host = h[1]
+			case Host:
+				r.Host = value
 				continue
-			}
-			if headerName(h[0]) == ContentType {
-				if strings.Contains(h[1], "application/x-www-form-urlencoded") {
+			case ContentType:
+				if strings.Contains(value, "application/x-www-form-urlencoded") {
 					r.HasForm = true
 				}
-				if strings.Contains(h[1], "multipart/form-data") {
+				if strings.Contains(value, "multipart/form-data") {
 					r.HasPostForm = true
 				}
 			}
-			headerValues := strings.Split(h[1], ",")
-			r.Header.AddHeaders(h[0], headerValues)
+			r.Header.AddHeader(key, value)
 		}
 	}
-}
-
-// https://url.spec.whatwg.org/#urlencoded-parsing
-// application/x-www-form-urlencoded parsing
-func (r *Request) parseForm(form string) {
-	var nameString, valueString string
-	urlValues := strings.Split(form, "&")
-	for _, value := range urlValues {
-		keyValue := strings.Split(value, "=")
-		if len(keyValue) == 2 {
-			nameString = keyValue[0]
-			valueString = keyValue[1]
-			// Replace any 0x2B (+) in name and value with 0x20 (SP).
-			valueString = strings.ReplaceAll(valueString, "+", " ")
-			r.Form.AddValue(nameString, valueString)
-		}
-	}
-}
-
-func (r *Request) getMultipartBoundaryDelimiter() string {
-	contentType := r.Header[string(ContentType)]
-	if contentType == nil {
-		return ""
+	// A message with both headers may be an attempt of request smuggling
+	// - RFC 7230, 3.3.3
+	if contentLengthSet && len(r.Header.Values(TransferEncoding)) != 0 {
+		r.pushError("Content-Length sent with Transfer-Encoding")
+		r.ContentLength = -1
 	}
-	subpart := "boundary="
-	multipart := strings.LastIndex(contentType[0], subpart)
-	if multipart != -1 {
-		return strings.ReplaceAll(contentType[0][multipart+len(subpart):], "\"", "")
-	}
-	return ""
 }
 
-func extractDataFormContent(content string) string {
-	content = strings.ReplaceAll(content, "\r\n", " ")
-	content = strings.ReplaceAll(content, ":", "")
-	content = strings.ReplaceAll(content, ";", "")
-	content = strings.ReplaceAll(content, "\"", "")
-	arr := strings.Split(content, " ")
-
-	var lenItem int
-	for _, item := range arr {
-		lenItem = len(item)
-		// if strings.Contains(item, "filename=") {
-		// if lenItem > len("filename=") {
-		// 	name += item[len("filename="):] + ";"
-		// }
-		// } else
-		if strings.Contains(item, "name=") {
-			if lenItem > len("name=") {
-				return item[len("name="):]
-			}
+// parseForm stores the values of an application/x-www-form-urlencoded body
+func (r *Request) parseForm(form string) {
+	for name, values := range ParseQuery(form) {
+		for _, value := range values {
+			r.Form.AddValue(name, value)
 		}
-		// if strings.Contains(item, "/") {
-		// 	name += item
-		// }
 	}
-	return ""
 }
 
-func (r *Request) parseDataForm(body string) {
-	var parts, items []string
-	var partSize int
-	// var nameItem string
-
-	delimiter := "--" + r.getMultipartBoundaryDelimiter()
-	parts = strings.Split(body, delimiter)
-	for _, part := range parts {
-		partSize = len(part)
-		// Skip part where "Content-Disposition" is not include
-		if partSize < len("Content-Disposition") {
-			continue
-		}
-		part = strings.TrimLeft(part, "\r\n")
-		// Handle part
-		items = strings.Split(part, "\r\n\r\n")
-		if len(items) == 2 {
-			r.PostForm.AddValue(
-				extractDataFormContent(items[0]),
-				items[1],
-			)
-		}
+// parseDataForm stores the values and the files of a multipart/form-data
+// body, the parts beyond maxMemory are stored in temporary files
+func (r *Request) parseDataForm(body string, maxMemory int64) {
+	err := r.readMultipartForm(strings.NewReader(body), maxMemory)
+	if err != nil {
+		r.pushError("Invalid multipart form: " + err.Error())
 	}
-	return
 }
 
-func (r *Request) parseBody(body string) {
+func (r *Request) parseBody(body string, maxMemory int64) {
 	r.Body = []byte(body)
 	if r.HasForm {
 		r.parseForm(body)
 	}
 	if r.HasPostForm {
-		r.parseDataForm(body)
+		r.parseDataForm(body, maxMemory)
 	}
 }
 
@@ -317,6 +304,6 @@ func (r *Request) RequestParse(headers string) error {
 		return errors.New("Not a valid reader format")
 	}
 	r.parseHeaders(headers[:bodyStart])
-	r.parseBody(headers[bodyStart+len(delimiter):])
+	r.parseBody(headers[bodyStart+len(delimiter):], DefaultMaxMemory)
 	return nil
 }
@@ -12,21 +12,9 @@ func TestRequestParseHeaderForm(t *testing.T) {
 	diff := pretty.Compare(&r, Request{
 		Method: "GET",
 		Header: map[string][]string{
-			"Accept": []string{
-				"text/html",
-				"application/xhtml+xml",
-				"application/xml;q=0.9",
-				"image/webp",
-				"*/*;q=0.8",
-			},
-			"Accept-Encoding": []string{
-				"gzip",
-				"deflate",
-			},
-			"Accept-Language": []string{
-				"en-US",
-				"en;q=0.5",
-			},
+			"Accept":                    []string{"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"},
+			"Accept-Encoding":           []string{"gzip, deflate"},
+			"Accept-Language":           []string{"en-US,en;q=0.5"},
 			"Connection":                []string{"keep-alive"},
 			"Content-Type":              []string{"application/x-www-form-urlencoded"},
 			"Upgrade-Insecure-Requests": []string{"1"},
@@ -51,7 +39,8 @@ func TestRequestParseHeaderForm(t *testing.T) {
 		Proto:        "HTTP/1.1",
 		ProtoMajor:   1,
 		ProtoMinor:   1,
-		URL:          "/form",
+		URL:          &URL{Path: "/form", RawPath: "/form"},
+		RequestURI:   "/form",
 	})
 	if diff != "" {
 		t.Error(diff)
@@ -64,21 +53,9 @@ func TestRequestParseHeaderMultipart(t *testing.T) {
 	diff := pretty.Compare(&r, Request{
 		Method: "POST",
 		Header: map[string][]string{
-			"Accept": []string{
-				"text/html",
-				"application/xhtml+xml",
-				"application/xml;q=0.9",
-				"image/webp",
-				"*/*;q=0.8",
-			},
-			"Accept-Encoding": []string{
-				"gzip",
-				"deflate",
-			},
-			"Accept-Language": []string{
-				"en-US",
-				"en;q=0.5",
-			},
+			"Accept":                    []string{"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"},
+			"Accept-Encoding":           []string{"gzip, deflate"},
+			"Accept-Language":           []string{"en-US,en;q=0.5"},
 			"Connection":                []string{"keep-alive"},
 			"Content-Type":              []string{"multipart/form-data; boundary=\"---------------------------20762440193078419611623191500\""},
 			"Upgrade-Insecure-Requests": []string{"1"},
@@ -89,18 +66,59 @@ func TestRequestParseHeaderMultipart(t *testing.T) {
 		Host:          "localhost:8084",
 		Form:          Values{},
 		HasForm:       false,
-		PostForm: map[string][]string{"file1": []string{"\r\n"},
-			"file2": []string{"<form action=\"http://localhost:8084\" method=\"post\" enctype=\"multipart/form-data\">\n  <p><input type=\"text\" name=\"text\" value=\"text default\">\n  <p><input type=\"file\" name=\"file1\">\n  <p><input type=\"file\" name=\"file2\">\n  <p><button type=\"submit\">Submit</button>\n</form>\n\r\n"},
-			"text":  []string{"valentin omnes\r\n"},
+		PostForm: map[string][]string{
+			"file1": []string{""},
+			"text":  []string{"valentin omnes"},
+		},
+		HasPostForm: true,
+		MultipartForm: &MultipartForm{
+			Value: Values{
+				"file1": []string{""},
+				"text":  []string{"valentin omnes"},
+			},
+			File: map[string][]*FileHeader{
+				"file2": []*FileHeader{{
+					Filename: "http.html",
+					Header: Header{
+						"Content-Disposition": []string{"form-data; name=\"file2\"; filename=\"http.html\""},
+						"Content-Type":        []string{"text/html"},
+					},
+					Size:    267,
+					content: []byte("<form action=\"http://localhost:8084\" method=\"post\" enctype=\"multipart/form-data\">\n  <p><input type=\"text\" name=\"text\" value=\"text default\">\n  <p><input type=\"file\" name=\"file1\">\n  <p><input type=\"file\" name=\"file2\">\n  <p><button type=\"submit\">Submit</button>\n</form>\n"),
+				}},
+			},
 		},
-		HasPostForm:  true,
 		ParsingError: []string{},
 		Proto:        "HTTP/1.1",
 		ProtoMajor:   1,
 		ProtoMinor:   1,
-		URL:          "/",
+		URL:          &URL{Path: "/", RawPath: "/"},
+		RequestURI:   "/",
 	})
 	if diff != "" {
 		t.Error(diff)
 	}
 }
+
+var keepAliveTests = []struct {
+	raw         string // input
+	expected    bool   // expected result
+	testContent string // test details
+}{
+	{"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", true, "HTTP/1.1 default"},
+	{"GET / HTTP/1.1\r\nConnection: close\r\n\r\n", false, "HTTP/1.1 with close"},
+	{"GET / HTTP/1.1\r\nconnection: Close\r\n\r\n", false, "HTTP/1.1 with close lower case"},
+	{"GET / HTTP/1.0\r\nHost: localhost\r\n\r\n", false, "HTTP/1.0 default"},
+	{"GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n", true, "HTTP/1.0 with keep-alive"},
+}
+
+func TestRequestKeepAlive(t *testing.T) {
+	for _, tt := range keepAliveTests {
+		r := InitRequest()
+		r.RequestParse(tt.raw)
+		if actual := r.keepAlive(); actual != tt.expected {
+			t.Errorf("keepAlive: expect %v, has %v - Test type: \033[31m%s\033[0m",
+				tt.expected, actual, tt.testContent)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	gonet "net"
+	"strconv"
+)
+
+// responseBufferSize is the size of the body kept in memory before sending
+// the headers, a body smaller than it is sent with a Content-Length header
+const responseBufferSize = 4096
+
+// ErrBodyNotAllowed is returned by Write when the status code or the
+// request method does not allow a body
+var ErrBodyNotAllowed = errors.New("http: request method or response status code does not allow body")
+
+// ResponseWriter is used by a handler to build and send the response
+type ResponseWriter interface {
+	// Header returns the headers sent with the response, they can't be
+	// changed once WriteHeader has been called
+	Header() Header
+	// WriteHeader sets the status code of the response
+	WriteHeader(code int)
+	// Write sends data as a part of the body, the status code 200 is used
+	// if WriteHeader has not been called
+	Write(data []byte) (int, error)
+}
+
+// Flusher is implemented by the ResponseWriter allowing to send the
+// buffered data to the client before the end of the handler
+type Flusher interface {
+	Flush() error
+}
+
+// Hijacker is implemented by the ResponseWriter of the server allowing a
+// handler to take over the connection, e.g. to switch to another protocol
+type Hijacker interface {
+	// Hijack returns the connection and the data received after the
+	// request. The server does not use the connection anymore: the
+	// response is not sent, the connection is not closed by Shutdown and
+	// its timeouts are removed, the handler must close it.
+	Hijack() (gonet.Conn, []byte, error)
+}
+
+// ErrHijacked is returned by the ResponseWriter once the connection has
+// been hijacked
+var ErrHijacked = errors.New("http: connection has been hijacked")
+
+// ErrNotSupported is returned by Hijack when the response is not sent by
+// a server
+var ErrNotSupported = errors.New("http: feature not supported")
+
+// response is the ResponseWriter given by the server to the handlers
+// The body is buffered until responseBufferSize to be sent with a
+// Content-Length header, beyond it is streamed with the chunked transfer
+// coding or until the connection is closed for HTTP/1.0 clients
+type response struct {
+	conn io.Writer
+	req  *Request
+
+	header      Header
+	status      int
+	wroteHeader bool // WriteHeader has been called
+	sentHeader  bool // Status line and headers have been sent
+
+	buf     bytes.Buffer
+	chunked bool
+	noBody  bool
+
+	contentLength int64 // Content-Length set by the handler, -1 if none
+	written       int64
+
+	// closeAfter is true if the connection must be closed after the response
+	closeAfter bool
+	// closing returns true once the server is shutting down, nil if the
+	// response is not sent by a server
+	closing func() bool
+	// hijack gives the connection to the handler, nil if the response is
+	// not sent by a server
+	hijack   func() (gonet.Conn, []byte, error)
+	hijacked bool
+}
+
+func newResponse(conn io.Writer, r *Request, keepAlive bool) *response {
+	return &response{
+		conn:          conn,
+		req:           r,
+		header:        Header{},
+		contentLength: -1,
+		closeAfter:    !keepAlive,
+		noBody:        r != nil && r.Method == "HEAD",
+	}
+}
+
+// bodyAllowed returns true if a response with the status code can have a
+// body - RFC 7230, 3.3
+func bodyAllowed(status int) bool {
+	if status >= 100 && status <= 199 {
+		return false
+	}
+	return status != StatusNoContent && status != StatusNotModified
+}
+
+func (w *response) Header() Header { return w.header }
+
+func (w *response) WriteHeader(code int) {
+	if w.hijacked {
+		fmt.Println("http: response.WriteHeader on hijacked connection")
+		return
+	}
+	if w.wroteHeader {
+		fmt.Println("http: superfluous response.WriteHeader call")
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	if !bodyAllowed(code) {
+		w.noBody = true
+	}
+	if value := w.header.Get(ContentLength); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+			w.contentLength = n
+		} else {
+			w.header.Del(ContentLength)
+		}
+	}
+}
+
+func (w *response) Write(data []byte) (int, error) {
+	if w.hijacked {
+		return 0, ErrHijacked
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if w.noBody {
+		if !bodyAllowed(w.status) {
+			return 0, ErrBodyNotAllowed
+		}
+		// HEAD response, the body is only counted for Content-Length
+		w.written += int64(len(data))
+		return len(data), nil
+	}
+	if w.contentLength != -1 && w.written+int64(len(data)) > w.contentLength {
+		return 0, errors.New("http: wrote more than the declared Content-Length")
+	}
+	w.written += int64(len(data))
+	w.buf.Write(data)
+	if w.buf.Len() > responseBufferSize {
+		if err := w.flush(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush sends the headers and the buffered body to the client
+func (w *response) Flush() error {
+	if w.hijacked {
+		return ErrHijacked
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	return w.flush(false)
+}
+
+// Hijack gives the connection to the handler, it fails once the status
+// code has been set
+func (w *response) Hijack() (gonet.Conn, []byte, error) {
+	if w.hijack == nil {
+		return nil, nil, ErrNotSupported
+	}
+	if w.hijacked {
+		return nil, nil, ErrHijacked
+	}
+	if w.wroteHeader {
+		return nil, nil, errors.New("http: Hijack after WriteHeader")
+	}
+	conn, buffered, err := w.hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	return conn, buffered, nil
+}
+
+// head returns the status line and the headers choosing how the body
+// length is given to the client, final is true if the whole body is
+// already buffered
+func (w *response) head(final bool) []byte {
+	w.sentHeader = true
+	switch {
+	case w.noBody:
+		// Answer a HEAD request with the length the body would have
+		if final && w.contentLength == -1 && bodyAllowed(w.status) {
+			w.header.Set(ContentLength, strconv.FormatInt(w.written, 10))
+		}
+	case w.contentLength != -1:
+	case final:
+		w.header.Set(ContentLength, strconv.Itoa(w.buf.Len()))
+	case w.req != nil && w.req.protoAtLeast(1, 1):
+		w.chunked = true
+		w.header.Set(TransferEncoding, "chunked")
+	default:
+		// HTTP/1.0 client, the end of the body is given by closing the connection
+		w.closeAfter = true
+	}
+	if w.header.HasToken(Connection, "close") || (w.closing != nil && w.closing()) {
+		w.closeAfter = true
+	}
+	if w.closeAfter {
+		w.header.Set(Connection, "close")
+	} else {
+		w.header.Set(Connection, "keep-alive")
+	}
+
+	var head bytes.Buffer
+	head.WriteString("HTTP/1.1 " + StatusString(w.status) + "\r\n")
+	w.header.write(&head)
+	head.WriteString("\r\n")
+	return head.Bytes()
+}
+
+// flush sends the headers if not done yet and the buffered body, in a
+// single write to not wait for the acknowledgment of the headers
+func (w *response) flush(final bool) error {
+	var data []byte
+	if !w.sentHeader {
+		data = w.head(final)
+	}
+	if w.buf.Len() != 0 {
+		if w.chunked {
+			data = append(data, strconv.FormatInt(int64(w.buf.Len()), 16)+"\r\n"...)
+			data = append(data, w.buf.Bytes()...)
+			data = append(data, "\r\n"...)
+		} else {
+			data = append(data, w.buf.Bytes()...)
+		}
+		w.buf.Reset()
+	}
+	if final && w.chunked {
+		data = append(data, "0\r\n\r\n"...)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := w.conn.Write(data)
+	return err
+}
+
+// finish sends what remains of the response once the handler returned,
+// nothing once the connection has been hijacked
+func (w *response) finish() error {
+	if w.hijacked {
+		return nil
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(StatusOK)
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	// The client would wait for the missing part of the body
+	if !w.noBody && w.contentLength != -1 && w.written != w.contentLength {
+		w.closeAfter = true
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var responseTests = []struct {
+	raw         string   // request
+	keepAlive   bool     // keep the connection open
+	body        string   // written by the handler
+	contains    []string // expected in the response
+	excludes    []string // not expected in the response
+	closeAfter  bool     // expected connection closing
+	testContent string   // test details
+}{
+	{
+		"GET / HTTP/1.1\r\n\r\n", true, "hello",
+		[]string{"HTTP/1.1 200 OK\r\n", "Content-Length: 5\r\n", "Connection: keep-alive\r\n", "\r\n\r\nhello"},
+		[]string{"Transfer-Encoding"},
+		false, "Small body",
+	},
+	{
+		"GET / HTTP/1.1\r\n\r\n", true, strings.Repeat("a", 5000),
+		[]string{"Transfer-Encoding: chunked\r\n", "\r\n\r\n1388\r\n" + strings.Repeat("a", 5000) + "\r\n0\r\n\r\n"},
+		[]string{"Content-Length"},
+		false, "Large body chunked",
+	},
+	{
+		"GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n", true, strings.Repeat("a", 5000),
+		[]string{"Connection: close\r\n", "\r\n\r\n" + strings.Repeat("a", 5000)},
+		[]string{"Content-Length", "Transfer-Encoding"},
+		true, "Large body to HTTP/1.0 client",
+	},
+	{
+		"HEAD / HTTP/1.1\r\n\r\n", true, "hello",
+		[]string{"Content-Length: 5\r\n"},
+		[]string{"hello"},
+		false, "HEAD request",
+	},
+	{
+		"GET / HTTP/1.1\r\n\r\n", false, "",
+		[]string{"Content-Length: 0\r\n", "Connection: close\r\n"},
+		nil,
+		true, "Empty body without keep-alive",
+	},
+}
+
+func TestResponse(t *testing.T) {
+	for _, tt := range responseTests {
+		r := InitRequest()
+		r.RequestParse(tt.raw)
+		var conn bytes.Buffer
+		w := newResponse(&conn, r, tt.keepAlive)
+		w.Write([]byte(tt.body))
+		if err := w.finish(); err != nil {
+			t.Errorf("finish: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			continue
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(conn.String(), s) {
+				t.Errorf("Response %q: expect %q - Test type: \033[31m%s\033[0m", conn.String(), s, tt.testContent)
+			}
+		}
+		for _, s := range tt.excludes {
+			if strings.Contains(conn.String(), s) {
+				t.Errorf("Response %q: unexpected %q - Test type: \033[31m%s\033[0m", conn.String(), s, tt.testContent)
+			}
+		}
+		if w.closeAfter != tt.closeAfter {
+			t.Errorf("closeAfter: expect %v, has %v - Test type: \033[31m%s\033[0m", tt.closeAfter, w.closeAfter, tt.testContent)
+		}
+	}
+}
+
+func TestResponseNoContent(t *testing.T) {
+	var conn bytes.Buffer
+	w := newResponse(&conn, InitRequest(), true)
+	w.WriteHeader(StatusNoContent)
+	if _, err := w.Write([]byte("body")); err != ErrBodyNotAllowed {
+		t.Errorf("Write: expect %v, has %v", ErrBodyNotAllowed, err)
+	}
+	w.finish()
+	if strings.Contains(conn.String(), "Content-Length") || !strings.HasPrefix(conn.String(), "HTTP/1.1 204 No Content\r\n") {
+		t.Errorf("Unexpected response %q", conn.String())
+	}
+}
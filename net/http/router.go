@@ -1,34 +1,182 @@
 package http
 
-type Handler func(w Headers, r *Request)
+import "strings"
+
+// Handler responds to a request using w to send the response
+type Handler func(w ResponseWriter, r *Request)
+
+// Middleware wraps a handler to add a behavior before or after it
+type Middleware func(next Handler) Handler
 
 type Route struct {
 	Handler Handler
 	name    string
+	method  string
+	router  *Router // router or group where the route was created
 }
 
+// anyMethod is the method key of the routes responding to every method
+const anyMethod = "*"
+
 type Router struct {
-	routes         map[string]Route
+	tree           *node
 	defaultHandler Handler
+
+	prefix      string
+	middlewares []Middleware
+	parent      *Router // nil except for a group
 }
 
 // NewRouter init and return the new router structure
 func NewRouter() *Router {
 	return &Router{
-		routes:         map[string]Route{},
-		defaultHandler: func(w Headers, r *Request) {},
+		tree:           &node{},
+		defaultHandler: func(w ResponseWriter, r *Request) {},
 	}
 }
 
 // AddRoute creates a new route repsonding to a url and a f function
+// whatever the method of the request
 func (r *Router) AddRoute(url string, f Handler) {
-	r.routes[url] = Route{
+	r.Handle(anyMethod, url, f)
+}
+
+// Handle creates a new route responding to a method and a url with
+// a f function. The url can contain named parameters like "/users/:id"
+// and end with a catch-all segment like "/static/*path", their values
+// are given by Request.Param.
+func (r *Router) Handle(method, url string, f Handler) {
+	if method != anyMethod && !validMethod(method) {
+		panic("http: invalid method " + method)
+	}
+	url = r.prefix + url
+	n := r.tree.insert(url)
+	if n.routes == nil {
+		n.routes = map[string]Route{}
+	}
+	n.routes[method] = Route{
 		Handler: f,
 		name:    url,
+		method:  method,
+		router:  r,
 	}
 }
 
+// GET creates a new route responding to the GET requests on url
+func (r *Router) GET(url string, f Handler) { r.Handle("GET", url, f) }
+
+// HEAD creates a new route responding to the HEAD requests on url
+func (r *Router) HEAD(url string, f Handler) { r.Handle("HEAD", url, f) }
+
+// POST creates a new route responding to the POST requests on url
+func (r *Router) POST(url string, f Handler) { r.Handle("POST", url, f) }
+
+// PUT creates a new route responding to the PUT requests on url
+func (r *Router) PUT(url string, f Handler) { r.Handle("PUT", url, f) }
+
+// PATCH creates a new route responding to the PATCH requests on url
+func (r *Router) PATCH(url string, f Handler) { r.Handle("PATCH", url, f) }
+
+// DELETE creates a new route responding to the DELETE requests on url
+func (r *Router) DELETE(url string, f Handler) { r.Handle("DELETE", url, f) }
+
+// OPTIONS creates a new route responding to the OPTIONS requests on url
+func (r *Router) OPTIONS(url string, f Handler) { r.Handle("OPTIONS", url, f) }
+
 // SetDefaultRoute set the handler function if the route doesn't exists
 func (r *Router) SetDefaultRoute(f Handler) {
-	r.defaultHandler = f
+	r.root().defaultHandler = f
+}
+
+// Use adds middlewares applied to the routes of the router and of its
+// groups, the first one added is the first one called
+func (r *Router) Use(mw ...Middleware) {
+	r.middlewares = append(r.middlewares, mw...)
+}
+
+// Group returns a sub-router creating its routes under prefix, they are
+// wrapped by the middlewares of the sub-router and of its parents
+func (r *Router) Group(prefix string) *Router {
+	return &Router{
+		tree:   r.tree,
+		prefix: r.prefix + strings.TrimSuffix(prefix, "/"),
+		parent: r,
+	}
+}
+
+func (r *Router) root() *Router {
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+// wrap returns h wrapped by the middlewares of the router and of its parents
+func (r *Router) wrap(h Handler) Handler {
+	for ; r != nil; r = r.parent {
+		for i := len(r.middlewares) - 1; i >= 0; i-- {
+			h = r.middlewares[i](h)
+		}
+	}
+	return h
+}
+
+// allowedMethods returns the value of the Allow header for the routes
+// of a url, HEAD is allowed with GET and OPTIONS is always allowed
+func allowedMethods(routes map[string]Route) string {
+	var allowed []string
+	_, get := routes["GET"]
+	for _, method := range METHODS {
+		_, ok := routes[method]
+		if ok || method == "OPTIONS" || (method == "HEAD" && get) {
+			allowed = append(allowed, method)
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// handler returns the handler responding to a request and the router
+// whose middlewares wrap it. When the url exists with other methods only
+// OPTIONS requests are answered with the allowed methods and the others
+// with 405 Method Not Allowed.
+func (r *Router) handler(req *Request) (Handler, *Router) {
+	root := r.root()
+	var params []Param
+	n := r.tree.match(req.URL.Path, &params)
+	if n == nil {
+		return root.defaultHandler, root
+	}
+	req.params = params
+	routes := n.routes
+	if route, ok := routes[req.Method]; ok {
+		return route.Handler, route.router
+	}
+	if route, ok := routes[anyMethod]; ok {
+		return route.Handler, route.router
+	}
+	// The response to a HEAD request is the one of GET without the body
+	if route, ok := routes["GET"]; ok && req.Method == "HEAD" {
+		return route.Handler, route.router
+	}
+	allowed := allowedMethods(routes)
+	if req.Method == "OPTIONS" {
+		return func(w ResponseWriter, r *Request) {
+			w.Header().Set(Allow, allowed)
+			w.WriteHeader(StatusNoContent)
+		}, root
+	}
+	return func(w ResponseWriter, r *Request) {
+		w.Header().Set(Allow, allowed)
+		w.Header().Set(ContentType, "text/plain; charset=utf-8")
+		w.WriteHeader(StatusMethodNotAllowed)
+		w.Write([]byte(StatusText(StatusMethodNotAllowed) + "\n"))
+	}, root
+}
+
+// serve calls the handler responding to the request wrapped by the
+// middlewares, the handlers not created by a route are only wrapped by
+// the middlewares of the root router
+func (r *Router) serve(w ResponseWriter, req *Request) {
+	h, router := r.handler(req)
+	router.wrap(h)(w, req)
 }
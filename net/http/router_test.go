@@ -0,0 +1,189 @@
+package http
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// serveRaw parses raw as a request, serves it with router and returns
+// the response sent
+func serveRaw(router *Router, raw string) string {
+	r := InitRequest()
+	r.RequestParse(raw)
+	var conn bytes.Buffer
+	w := newResponse(&conn, r, true)
+	router.serve(w, r)
+	w.finish()
+	return conn.String()
+}
+
+func newMethodRouter() *Router {
+	router := NewRouter()
+	router.GET("/bonjour", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("get"))
+	})
+	router.POST("/bonjour", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("post"))
+	})
+	router.DELETE("/delete", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("delete"))
+	})
+	router.AddRoute("/any", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("any " + r.Method))
+	})
+	router.SetDefaultRoute(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusNotFound)
+	})
+	return router
+}
+
+var routerMethodTests = []struct {
+	raw         string   // request
+	contains    []string // expected in the response
+	testContent string   // test details
+}{
+	{"GET /bonjour HTTP/1.1\r\n\r\n", []string{"200 OK", "\r\n\r\nget"}, "GET route"},
+	{"POST /bonjour HTTP/1.1\r\n\r\n", []string{"200 OK", "\r\n\r\npost"}, "POST route on the same url"},
+	{"PUT /bonjour HTTP/1.1\r\n\r\n", []string{"405 Method Not Allowed", "Allow: OPTIONS, GET, HEAD, POST\r\n"}, "Method not allowed"},
+	{"OPTIONS /bonjour HTTP/1.1\r\n\r\n", []string{"204 No Content", "Allow: OPTIONS, GET, HEAD, POST\r\n"}, "Automatic OPTIONS"},
+	{"HEAD /bonjour HTTP/1.1\r\n\r\n", []string{"200 OK", "Content-Length: 3\r\n"}, "Automatic HEAD"},
+	{"GET /delete HTTP/1.1\r\n\r\n", []string{"405 Method Not Allowed", "Allow: OPTIONS, DELETE\r\n"}, "HEAD not allowed without GET"},
+	{"PUT /any HTTP/1.1\r\n\r\n", []string{"200 OK", "any PUT"}, "Route for every method"},
+	{"GET /missing HTTP/1.1\r\n\r\n", []string{"404 Not Found"}, "Default route"},
+}
+
+func TestRouterMethods(t *testing.T) {
+	router := newMethodRouter()
+	for _, tt := range routerMethodTests {
+		actual := serveRaw(router, tt.raw)
+		for _, s := range tt.contains {
+			if !strings.Contains(actual, s) {
+				t.Errorf("Response %q: expect %q - Test type: \033[31m%s\033[0m", actual, s, tt.testContent)
+			}
+		}
+	}
+	if actual := serveRaw(router, "HEAD /bonjour HTTP/1.1\r\n\r\n"); strings.HasSuffix(actual, "get") {
+		t.Errorf("Response %q: unexpected body to HEAD request", actual)
+	}
+}
+
+func newParamRouter() *Router {
+	router := NewRouter()
+	routes := []string{
+		"/users",
+		"/users/new",
+		"/users/:id",
+		"/users/:id/posts/:post",
+		"/static/*path",
+		"/static/favicon.ico",
+		"/src/:file",
+		"/src/*path",
+		"/search",
+		"/see/:what",
+	}
+	for _, pattern := range routes {
+		pattern := pattern
+		router.GET(pattern, func(w ResponseWriter, r *Request) {
+			w.Write([]byte(pattern + " " + r.Param("id") + r.Param("post") + r.Param("path") + r.Param("file") + r.Param("what")))
+		})
+	}
+	router.SetDefaultRoute(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusNotFound)
+	})
+	return router
+}
+
+var routerParamTests = []struct {
+	url         string // requested url
+	expected    string // expected body
+	testContent string // test details
+}{
+	{"/users", "/users ", "Static route"},
+	{"/users/new", "/users/new ", "Static over parameter"},
+	{"/users/42", "/users/:id 42", "Named parameter"},
+	{"/users/42?sort=asc", "/users/:id 42", "Query string ignored"},
+	{"/users/42/posts/7", "/users/:id/posts/:post 427", "Two named parameters"},
+	{"/static/css/main.css", "/static/*path css/main.css", "Catch-all segment"},
+	{"/static/favicon.ico", "/static/favicon.ico ", "Static over catch-all"},
+	{"/src/main.go", "/src/:file main.go", "Parameter over catch-all"},
+	{"/src/net/conn.go", "/src/*path net/conn.go", "Catch-all after parameter mismatch"},
+	{"/search", "/search ", "Static with shared prefix"},
+	{"/see/all", "/see/:what all", "Parameter with shared prefix"},
+}
+
+func TestRouterParams(t *testing.T) {
+	router := newParamRouter()
+	for _, tt := range routerParamTests {
+		actual := serveRaw(router, "GET "+tt.url+" HTTP/1.1\r\n\r\n")
+		if !strings.HasSuffix(actual, "\r\n\r\n"+tt.expected) {
+			t.Errorf("GET %s: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.url, tt.expected, actual, tt.testContent)
+		}
+	}
+	for _, url := range []string{"/users/42/posts", "/user", "/users/42/other/7", "/se"} {
+		if actual := serveRaw(router, "GET "+url+" HTTP/1.1\r\n\r\n"); !strings.Contains(actual, "404 Not Found") {
+			t.Errorf("GET %s: expect 404, has %q", url, actual)
+		}
+	}
+}
+
+func TestRouterParamConflict(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Handle: expect a panic for conflicting parameters")
+		}
+	}()
+	router := NewRouter()
+	router.GET("/users/:id", func(w ResponseWriter, r *Request) {})
+	router.GET("/users/:name/posts", func(w ResponseWriter, r *Request) {})
+}
+
+// trace returns a middleware writing name before and after the handler
+func trace(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(w ResponseWriter, r *Request) {
+			w.Write([]byte(name + ">"))
+			next(w, r)
+			w.Write([]byte("<" + name))
+		}
+	}
+}
+
+func TestRouterMiddlewareGroup(t *testing.T) {
+	router := NewRouter()
+	router.Use(trace("log"))
+	router.GET("/", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("home"))
+	})
+	api := router.Group("/api/v1/")
+	api.Use(trace("auth"), trace("json"))
+	api.GET("/users/:id", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("user " + r.Param("id")))
+	})
+	admin := api.Group("/admin")
+	admin.POST("/", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("admin"))
+	})
+	// Added after the groups creation, still inherited
+	router.Use(trace("recover"))
+	router.SetDefaultRoute(func(w ResponseWriter, r *Request) {
+		w.Write([]byte("default"))
+	})
+
+	tests := []struct {
+		raw         string // request
+		expected    string // expected body
+		testContent string // test details
+	}{
+		{"GET / HTTP/1.1\r\n\r\n", "log>recover>home<recover<log", "Root middlewares"},
+		{"GET /api/v1/users/42 HTTP/1.1\r\n\r\n", "log>recover>auth>json>user 42<json<auth<recover<log", "Group middlewares"},
+		{"POST /api/v1/admin/ HTTP/1.1\r\n\r\n", "log>recover>auth>json>admin<json<auth<recover<log", "Nested group"},
+		{"GET /users/42 HTTP/1.1\r\n\r\n", "log>recover>default<recover<log", "Default route"},
+	}
+	for _, tt := range tests {
+		actual := serveRaw(router, tt.raw)
+		if !strings.HasSuffix(actual, "\r\n\r\n"+tt.expected) {
+			t.Errorf("Response %q: expect %q - Test type: \033[31m%s\033[0m", actual, tt.expected, tt.testContent)
+		}
+	}
+}
@@ -1,9 +1,20 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	gonet "net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"../../net"
+	"golang.org/x/sys/unix"
 )
 
 // socket, accept, listen, send, recv, bind, connect, inet_addr,
@@ -14,76 +25,472 @@ import (
 // https://www.gnu.org/software/libc/manual/html_node/Server-Example.html
 // https://www.tenouk.com/Module41.html
 
+const (
+	// DefaultIdleTimeout is the time a connection is kept open waiting
+	// for the next request
+	DefaultIdleTimeout = 30 * time.Second
+	// DefaultMaxRequestsPerConn is the number of requests served on a
+	// connection before closing it
+	DefaultMaxRequestsPerConn = 100
+)
+
+// ServerConfig holds the limits applied by the server while reading requests
+// and keeping connections alive
+// A zero value field means the default value is used
+type ServerConfig struct {
+	MaxHeaderBytes     int           // Maximum size of the request line and headers
+	MaxBodyBytes       int64         // Maximum size of a request body
+	IdleTimeout        time.Duration // Maximum time waiting for the next request
+	MaxRequestsPerConn int           // Maximum number of requests on a connection
+	MaxMemory          int64         // Maximum size of the multipart parts kept in memory
+	Mode               ServeMode     // How the connections are served
+	// Listen contains the options of the listening socket,
+	// net.DefaultListenConfig if nil
+	Listen *net.ListenConfig
+}
+
+// ServeMode selects how the server waits for the data of the connections
+type ServeMode int
+
+const (
+	// ModeGoroutine serves each connection on its own goroutine with
+	// blocking syscalls
+	ModeGoroutine ServeMode = iota
+	// ModeEpoll serves all the connections on an epoll event loop, a
+	// goroutine only runs while a handler answers a request.
+	// It is only available on Linux, ModeSelect is used elsewhere.
+	ModeEpoll
+	// ModeSelect serves all the connections on a select(2) event loop,
+	// it is portable but limited to FD_SETSIZE connections
+	ModeSelect
+)
+
+func (c ServerConfig) maxHeaderBytes() int {
+	if c.MaxHeaderBytes > 0 {
+		return c.MaxHeaderBytes
+	}
+	return DefaultMaxHeaderBytes
+}
+
+func (c ServerConfig) maxBodyBytes() int64 {
+	if c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+func (c ServerConfig) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return c.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+func (c ServerConfig) maxRequestsPerConn() int {
+	if c.MaxRequestsPerConn > 0 {
+		return c.MaxRequestsPerConn
+	}
+	return DefaultMaxRequestsPerConn
+}
+
+func (c ServerConfig) maxMemory() int64 {
+	if c.MaxMemory > 0 {
+		return c.MaxMemory
+	}
+	return DefaultMaxMemory
+}
+
 type server struct {
 	socket net.TCPServer
 	router *Router
+	config ServerConfig
+	loop   net.Loop // event loop serving the connections, nil in ModeGoroutine
+	// tlsConfig is the configuration of the TLS connections, nil for
+	// cleartext connections
+	tlsConfig *tls.Config
+
+	mu      sync.Mutex
+	conns   map[int]bool // fd -> idle, the connections served in ModeGoroutine
+	closing bool         // set by Shutdown
+	stopped bool         // set once run has returned
 }
 
 func (s *server) SetRouter(router *Router) {
 	s.router = router
 }
 
-func (s *server) run() {
+// writeError answers a request which could not be read with the status
+// code of the error, the connection is closed after it
+func writeError(conn io.Writer, e statusError) {
+	w := newResponse(conn, nil, false)
+	w.Header().Set(ContentType, "text/plain; charset=utf-8")
+	w.WriteHeader(e.code)
+	w.Write([]byte(e.text + "\n"))
+	if err := w.finish(); err != nil {
+		fmt.Println("Write:", err)
+	}
+}
+
+// setIdle records whether the connection fd waits for a request, it
+// returns false if the connection must be closed instead of waiting
+func (s *server) setIdle(fd int, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = map[int]bool{}
+	}
+	if idle && s.closing {
+		return false
+	}
+	s.conns[fd] = idle
+	return true
+}
+
+func (s *server) forget(fd int) {
+	s.mu.Lock()
+	delete(s.conns, fd)
+	s.mu.Unlock()
+}
+
+func (s *server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+// serve handles the requests received on a connection until the client
+// or the server decides to close it
+func (s *server) serve(c net.Conn) {
+	var conn gonet.Conn = &c
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			s.forget(c.Fd)
+			conn.Close()
+		}
+	}()
+
+	// * The deadline is absolute, a client sending a byte from time to
+	// time does not keep the connection open
+	err := c.SetReadDeadline(time.Now().Add(s.config.idleTimeout()))
+	if err != nil {
+		fmt.Println("SetReadDeadline:", err)
+		return
+	}
+	var tlsState *tls.ConnectionState
+	if s.tlsConfig != nil {
+		tlsConn := tls.Server(&c, s.tlsConfig)
+		conn = tlsConn
+		// * The handshake is limited by the idle timeout
+		if err = tlsConn.Handshake(); err != nil {
+			fmt.Println("TLS handshake:", err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+	cr := newConnReader(conn)
+	for served := 1; ; served++ {
+		if !s.setIdle(c.Fd, true) {
+			return
+		}
+		// * The request line and the headers must be received within the
+		// idle timeout, the body within the idle timeout between reads
+		idleTimeout := s.config.idleTimeout()
+		if err = cr.setDeadline(time.Now().Add(idleTimeout), idleTimeout); err != nil {
+			fmt.Println("SetReadDeadline:", err)
+			return
+		}
+		// * The connection is busy from the first byte of a request, a
+		// request being received when Shutdown is called is answered
+		err = cr.wait()
+		s.setIdle(c.Fd, false)
+		var r *Request
+		if err == nil {
+			r, err = readRequest(cr, s.config)
+		}
+		if err != nil {
+			if e, ok := err.(statusError); ok {
+				writeError(conn, e)
+			} else if err != io.EOF && err != errReadTimeout {
+				fmt.Println("Read:", err)
+			}
+			return
+		}
+		r.TLS = tlsState
+		keepAlive := r.keepAlive() && served < s.config.maxRequestsPerConn()
+		w := newResponse(conn, r, keepAlive)
+		w.closing = s.isClosing
+		w.hijack = func() (gonet.Conn, []byte, error) {
+			// * The idle timeout of the server does not apply anymore
+			if err := cr.setDeadline(time.Time{}, 0); err != nil {
+				return nil, nil, err
+			}
+			hijacked = true
+			s.forget(c.Fd)
+			return conn, cr.takeBuffered(), nil
+		}
+
+		fmt.Println("Message:", r.Method, r.RequestURI)
+		s.router.serve(w, r)
+		if r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
+		}
+		if hijacked {
+			return
+		}
+		if err = w.finish(); err != nil {
+			fmt.Println("Write:", err)
+			return
+		}
+		if w.closeAfter {
+			return
+		}
+	}
+}
+
+// newLoop returns the event loop of the mode of the server, nil in
+// ModeGoroutine and for TLS
+func (s *server) newLoop() (net.Loop, error) {
+	if s.tlsConfig != nil {
+		return nil, nil
+	}
+	idleTimeout := s.config.idleTimeout()
+	switch {
+	case s.config.Mode == ModeEpoll && net.EpollSupported:
+		return net.NewEpollLoop(s.socket, s.loopHandler(), idleTimeout)
+	case s.config.Mode == ModeEpoll, s.config.Mode == ModeSelect:
+		return net.NewSelectLoop(s.socket, s.loopHandler(), idleTimeout)
+	}
+	return nil, nil
+}
+
+// run serves the connections of the listening socket until Shutdown, it
+// returns ErrServerClosed after Shutdown or the error of the event loop
+func (s *server) run() error {
+	defer func() {
+		s.mu.Lock()
+		s.stopped = true
+		s.mu.Unlock()
+	}()
+	l, err := s.newLoop()
+	if err != nil {
+		return err
+	}
+	if l != nil {
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			return ErrServerClosed
+		}
+		s.loop = l
+		s.mu.Unlock()
+		if err = l.Run(); err == nil && s.isClosing() {
+			err = ErrServerClosed
+		}
+		return err
+	}
 	for {
 		c, err := s.socket.Accept()
+		if s.isClosing() {
+			if err == nil {
+				c.Close()
+			}
+			return ErrServerClosed
+		}
 		if err != nil {
 			fmt.Println("Accept:", err)
 			continue
 		}
 		fmt.Println("Connection accepted on port:", c.Fd)
-		go func(c net.Conn) {
-			msg := make([]byte, 1024)
-			_, err = c.Read(&msg)
-			if err != nil {
-				fmt.Println("Read:", err)
-				c.Close()
-			}
-
-			// == Parse recv message - HTTP Type == //
-			h := NewHeader()
-			h.SetVersion("1.1")
-			r := InitRequest()
-			r.RequestParse(string(msg))
-			fmt.Println("Message:", r.Method, r.URL)
-			route := s.router.routes[r.URL]
-			if route.Handler != nil {
-				route.Handler(*h, r)
-			} else {
-				s.router.defaultHandler(*h, r)
-			}
-			err = c.Write(h.Bytes())
-			if err != nil {
-				fmt.Println("Write:", err)
-				c.Close()
-			}
-			c.Close()
-		}(c)
+		go s.serve(c)
 	}
 }
 
-// ListenAndServe will launch the server on a given port
-func ListenAndServe(port int, router *Router) {
-	s := server{}
-	s.SetRouter(router)
-	tcpSocket, err := net.Dial(port)
-	if err != nil {
-		fmt.Println(err)
+// close stops accepting the connections and closes the idle ones, the
+// others are closed after their current response. A connection is idle
+// until the first byte of a request is received.
+func (s *server) close() {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
 		return
 	}
-	s.socket = tcpSocket
-	err = s.socket.Listen()
+	s.closing = true
+	loop := s.loop
+	if loop == nil {
+		// * Shutdown wakes up the goroutine blocked in Accept
+		unix.Shutdown(s.socket.Fd, unix.SHUT_RDWR)
+		unix.Close(s.socket.Fd)
+	}
+	for fd, idle := range s.conns {
+		if idle {
+			unix.Shutdown(fd, unix.SHUT_RDWR)
+		}
+	}
+	s.mu.Unlock()
+	if loop != nil {
+		loop.Drain()
+	}
+}
+
+// closeAll closes the connections still open
+func (s *server) closeAll() {
+	s.mu.Lock()
+	loop := s.loop
+	for fd := range s.conns {
+		unix.Shutdown(fd, unix.SHUT_RDWR)
+	}
+	s.mu.Unlock()
+	if loop != nil {
+		loop.Stop()
+	}
+}
+
+// finished returns true once run has returned and every connection is
+// closed
+func (s *server) finished() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped && len(s.conns) == 0
+}
+
+// ErrServerClosed is returned by ListenAndServe after Shutdown
+var ErrServerClosed = errors.New("http: Server closed")
+
+// shutdownPollInterval is the interval Shutdown checks that the
+// connections are closed
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Server serves the requests of Router on Addr "host:port" using the
+// limits of Config, it is stopped by Shutdown
+type Server struct {
+	Addr   string
+	Router *Router
+	Config ServerConfig
+	// TLSConfig is used by ListenAndServeTLS: certificates, minimum
+	// version, cipher suites, nil for the defaults
+	TLSConfig *tls.Config
+
+	mu       sync.Mutex
+	srv      *server
+	shutdown bool
+	done     chan struct{} // closed once Shutdown has returned
+}
+
+// doneChan returns the channel closed once Shutdown has returned
+func (srv *Server) doneChan() chan struct{} {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.done == nil {
+		srv.done = make(chan struct{})
+	}
+	return srv.done
+}
+
+// ListenAndServe listens on srv.Addr and serves the connections, it
+// returns ErrServerClosed once Shutdown has returned
+func (srv *Server) ListenAndServe() error {
+	return srv.listenAndServe(nil)
+}
+
+// listenAndServe serves the connections, over TLS if tlsConfig is set
+func (srv *Server) listenAndServe(tlsConfig *tls.Config) error {
+	srv.mu.Lock()
+	if srv.shutdown {
+		srv.mu.Unlock()
+		return ErrServerClosed
+	}
+	if srv.srv != nil {
+		srv.mu.Unlock()
+		return errors.New("http: Server already started")
+	}
+	listenConfig := net.DefaultListenConfig
+	if srv.Config.Listen != nil {
+		listenConfig = *srv.Config.Listen
+	}
+	tcpSocket, err := listenConfig.Listen(srv.Addr)
 	if err != nil {
-		fmt.Printf("Listen: %s", err.Error())
-		return
+		srv.mu.Unlock()
+		return err
 	}
+	s := &server{socket: tcpSocket, router: srv.Router, config: srv.Config, tlsConfig: tlsConfig}
+	srv.srv = s
+	srv.mu.Unlock()
 	fmt.Printf("Server is running on %s\n", s.socket.GetAddr())
-	s.run()
+	err = s.run()
+	if err == ErrServerClosed {
+		// The active connections are still being drained
+		<-srv.doneChan()
+	}
+	return err
+}
+
+// Shutdown stops the server: the listening socket is closed, the idle
+// connections are closed and the active ones once their current response
+// is sent. It returns once every connection is closed or, if ctx expires
+// before, closes the connections left and returns the error of ctx.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	done := srv.doneChan()
+	srv.mu.Lock()
+	srv.shutdown = true
+	s := srv.srv
+	srv.mu.Unlock()
+	defer func() {
+		srv.mu.Lock()
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+		srv.mu.Unlock()
+	}()
+	if s == nil {
+		return nil
+	}
+	s.close()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for !s.finished() {
+		select {
+		case <-ctx.Done():
+			s.closeAll()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
 
-// // func SetsockoptInet4Addr(fd, level, opt int, value [4]byte) error
-// // level argument specifies the protocol level at which the option resides
-// // option_name argument specifies a single option to set. The option_name argument and any specified options are passed uninterpreted to the appropriate protocol module for interpretations
-// err = unix.SetsockoptInet4Addr(socketFD, unix.IPPROTO_IP, unix.SO_REUSEADDR, [4]byte{78, 238, 249, 32})
-// if err != nil {
-// 	log.Fatalln("SetsockoptInet4Addr", err)
-// }
+// ShutdownOnSignal calls Shutdown with a deadline of timeout once one of
+// signals is received, SIGINT and SIGTERM if none is given
+func (srv *Server) ShutdownOnSignal(timeout time.Duration, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		sig := <-ch
+		signal.Stop(ch)
+		fmt.Println("Shutdown:", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			fmt.Println("Shutdown:", err)
+		}
+	}()
+}
+
+// ListenAndServe will launch the server on the address "host:port",
+// ":8080" listens on every address of the port 8080
+func ListenAndServe(addr string, router *Router) error {
+	return ListenAndServeWithConfig(addr, router, ServerConfig{})
+}
+
+// ListenAndServeWithConfig will launch the server on the address
+// "host:port" using the limits of config
+func ListenAndServeWithConfig(addr string, router *Router, config ServerConfig) error {
+	srv := &Server{Addr: addr, Router: router, Config: config}
+	return srv.ListenAndServe()
+}
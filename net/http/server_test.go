@@ -0,0 +1,419 @@
+package http
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"../../net"
+	"golang.org/x/sys/unix"
+)
+
+// startServer runs srv on a free local port, it returns the url of the
+// server and the channel receiving the result of ListenAndServe
+func startServer(t *testing.T, srv *Server) (string, chan error) {
+	return startServerWith(t, srv, srv.ListenAndServe)
+}
+
+// startServerWith runs srv on a free local port with listenAndServe
+func startServerWith(t *testing.T, srv *Server, listenAndServe func() error) (string, chan error) {
+	srv.Addr = "127.0.0.1:0"
+	errc := make(chan error, 1)
+	go func() { errc <- listenAndServe() }()
+	for i := 0; ; i++ {
+		srv.mu.Lock()
+		s := srv.srv
+		srv.mu.Unlock()
+		if s != nil {
+			port := s.socket.Addr.(*unix.SockaddrInet4).Port
+			return "http://127.0.0.1:" + strconv.Itoa(port), errc
+		}
+		if i == 1000 {
+			t.Fatal("ListenAndServe: the server is not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newSlowRouter answers /slow once started is signaled and d has elapsed
+func newSlowRouter(started chan struct{}, d time.Duration) *Router {
+	router := newPoolRouter()
+	router.GET("/wait", func(w ResponseWriter, r *Request) {
+		started <- struct{}{}
+		time.Sleep(d)
+		w.Write([]byte("done"))
+	})
+	return router
+}
+
+var shutdownModes = []struct {
+	mode        ServeMode // mode of the server
+	testContent string    // test details
+}{
+	{ModeGoroutine, "Goroutine"},
+	{ModeEpoll, "Epoll"},
+	{ModeSelect, "Select"},
+}
+
+func TestServerShutdown(t *testing.T) {
+	for _, tt := range shutdownModes {
+		started := make(chan struct{}, 1)
+		srv := &Server{Router: newSlowRouter(started, 200*time.Millisecond), Config: ServerConfig{Mode: tt.mode}}
+		url, errc := startServer(t, srv)
+		port, _ := strconv.Atoi(url[len("http://127.0.0.1:"):])
+
+		// An idle keep-alive connection
+		idle, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idle.SetReadTimeout(2 * time.Second)
+		idle.Write([]byte("GET /hello HTTP/1.1\r\n\r\n"))
+		cr := newConnReader(&idle)
+		if _, err := readResponse(cr, &Request{Method: "GET"}); err != nil {
+			t.Fatalf("readResponse: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		}
+
+		// An active request
+		c := &Client{}
+		type result struct {
+			resp *Response
+			err  error
+		}
+		active := make(chan result, 1)
+		go func() {
+			req, _ := NewRequest("GET", url+"/wait", nil)
+			resp, err := c.Do(&req)
+			active <- result{resp, err}
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		}
+		cancel()
+		if r := <-active; r.err != nil || string(r.resp.Body) != "done" {
+			t.Errorf("Active request: expect done, has %v - Test type: \033[31m%s\033[0m", r.err, tt.testContent)
+		} else if !r.resp.Close {
+			t.Errorf("Active request: expect the connection closed - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+		if _, err := readResponse(cr, &Request{Method: "GET"}); err == nil {
+			t.Errorf("Idle connection: expect closed - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+		idle.Close()
+		if err := <-errc; err != ErrServerClosed {
+			t.Errorf("ListenAndServe: expect %v, has %v - Test type: \033[31m%s\033[0m", ErrServerClosed, err, tt.testContent)
+		}
+		if conn, err := net.Connect(net.IP{127, 0, 0, 1}, port); err == nil {
+			conn.Close()
+			t.Errorf("Connect: expect refused - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+		c.CloseIdleConnections()
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	for _, tt := range shutdownModes {
+		started := make(chan struct{}, 1)
+		srv := &Server{Router: newSlowRouter(started, time.Second), Config: ServerConfig{Mode: tt.mode}}
+		url, errc := startServer(t, srv)
+
+		active := make(chan error, 1)
+		go func() {
+			req, _ := NewRequest("GET", url+"/wait", nil)
+			_, err := (&Client{}).Do(&req)
+			active <- err
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Shutdown: expect %v, has %v - Test type: \033[31m%s\033[0m", context.DeadlineExceeded, err, tt.testContent)
+		}
+		cancel()
+		if err := <-active; err == nil {
+			t.Errorf("Active request: expect an error - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+		if err := <-errc; err != ErrServerClosed {
+			t.Errorf("ListenAndServe: expect %v, has %v - Test type: \033[31m%s\033[0m", ErrServerClosed, err, tt.testContent)
+		}
+	}
+}
+
+func TestServerShutdownPartialRequest(t *testing.T) {
+	for _, tt := range shutdownModes {
+		srv := &Server{Router: newPoolRouter(), Config: ServerConfig{Mode: tt.mode}}
+		url, errc := startServer(t, srv)
+		port, _ := strconv.Atoi(url[len("http://127.0.0.1:"):])
+
+		conn, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadTimeout(2 * time.Second)
+		// The request is being received when Shutdown is called
+		conn.Write([]byte("GET /hello HTTP/1.1\r\n"))
+		time.Sleep(50 * time.Millisecond)
+		shutdown := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			shutdown <- srv.Shutdown(ctx)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		conn.Write([]byte("\r\n"))
+		resp, err := readResponse(newConnReader(&conn), &Request{Method: "GET"})
+		if err != nil || string(resp.Body) != "hello" {
+			t.Errorf("Response: expect hello, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		} else if !resp.Close {
+			t.Errorf("Response: expect the connection closed - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+		conn.Close()
+		if err := <-shutdown; err != nil {
+			t.Errorf("Shutdown: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		}
+		<-errc
+	}
+}
+
+func TestServerShutdownOnSignal(t *testing.T) {
+	srv := &Server{Router: newPoolRouter()}
+	srv.ShutdownOnSignal(time.Second, syscall.SIGUSR1)
+	_, errc := startServer(t, srv)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case err := <-errc:
+		if err != ErrServerClosed {
+			t.Errorf("ListenAndServe: expect %v, has %v", ErrServerClosed, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("ListenAndServe: expect the server stopped by the signal")
+	}
+}
+
+// newHijackRouter answers /hijack by echoing on the hijacked connection
+// the data received after the request
+func newHijackRouter() *Router {
+	router := newPoolRouter()
+	router.GET("/hijack", func(w ResponseWriter, r *Request) {
+		conn, buffered, err := w.(Hijacker).Hijack()
+		if err != nil {
+			w.WriteHeader(StatusInternalServerError)
+			return
+		}
+		if _, err = w.Write([]byte("ignored")); err != ErrHijacked {
+			conn.Write([]byte("Write after Hijack: " + err.Error()))
+		}
+		go func() {
+			defer conn.Close()
+			conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n"))
+			conn.Write(buffered)
+			buf := make([]byte, 64)
+			for {
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				conn.Write(buf[:n])
+			}
+		}()
+	})
+	return router
+}
+
+func TestServerHijack(t *testing.T) {
+	for _, tt := range shutdownModes {
+		srv := &Server{Router: newHijackRouter(), Config: ServerConfig{Mode: tt.mode, IdleTimeout: 100 * time.Millisecond}}
+		url, errc := startServer(t, srv)
+		port, _ := strconv.Atoi(url[len("http://127.0.0.1:"):])
+
+		conn, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadTimeout(2 * time.Second)
+		// The data sent with the request is given to the handler
+		conn.Write([]byte("GET /hijack HTTP/1.1\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\nfirst"))
+		cr := newConnReader(&conn)
+		resp, err := readResponse(cr, &Request{Method: "GET"})
+		if err != nil || resp.StatusCode != StatusSwitchingProtocols {
+			t.Fatalf("readResponse: expect 101, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		}
+		expect := "first"
+		// The idle timeout of the server does not close the connection
+		time.Sleep(200 * time.Millisecond)
+		conn.Write([]byte("second"))
+		expect += "second"
+		has := string(cr.takeBuffered())
+		buf := make([]byte, 64)
+		for len(has) < len(expect) {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Errorf("Read: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+				break
+			}
+			has += string(buf[:n])
+		}
+		if has != expect {
+			t.Errorf("Echo: expect %q, has %q - Test type: \033[31m%s\033[0m", expect, has, tt.testContent)
+		}
+
+		// Shutdown does not wait for the hijacked connection
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		}
+		cancel()
+		<-errc
+		if _, err := conn.Write([]byte("third")); err != nil {
+			t.Errorf("Write after Shutdown: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+		} else if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "third" {
+			t.Errorf("Echo after Shutdown: expect third, has %q %v - Test type: \033[31m%s\033[0m", buf[:n], err, tt.testContent)
+		}
+		conn.Close()
+	}
+}
+
+func TestServerSlowClient(t *testing.T) {
+	for _, tt := range shutdownModes {
+		srv := &Server{Router: newPoolRouter(), Config: ServerConfig{Mode: tt.mode, IdleTimeout: 300 * time.Millisecond}}
+		url, errc := startServer(t, srv)
+		port, _ := strconv.Atoi(url[len("http://127.0.0.1:"):])
+
+		conn, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadTimeout(5 * time.Second)
+		closed := make(chan struct{})
+		go func() {
+			buf := make([]byte, 64)
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					close(closed)
+					return
+				}
+			}
+		}()
+		// A byte sent before each idle timeout does not keep the request open
+		start := time.Now()
+		conn.Write([]byte("GET /hello HTTP/1.1\r\nX-Slow: "))
+	send:
+		for time.Since(start) < 3*time.Second {
+			select {
+			case <-closed:
+				break send
+			case <-time.After(100 * time.Millisecond):
+				conn.Write([]byte("z"))
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Close: expect the connection closed after the idle timeout, has %v - Test type: \033[31m%s\033[0m", elapsed, tt.testContent)
+		}
+		<-closed
+		conn.Close()
+		srv.Shutdown(context.Background())
+		<-errc
+	}
+}
+
+func TestServerSlowBody(t *testing.T) {
+	for _, tt := range shutdownModes {
+		srv := &Server{Router: newEchoRouter(), Config: ServerConfig{Mode: tt.mode, IdleTimeout: 300 * time.Millisecond}}
+		url, errc := startServer(t, srv)
+		port, _ := strconv.Atoi(url[len("http://127.0.0.1:"):])
+
+		conn, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadTimeout(5 * time.Second)
+		// A body sent steadily for longer than the idle timeout is received
+		const body = "slow but steady body"
+		conn.Write([]byte("POST /echo HTTP/1.1\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"))
+		for i := 0; i < len(body); i++ {
+			time.Sleep(60 * time.Millisecond)
+			conn.Write([]byte{body[i]})
+		}
+		resp, err := readResponse(newConnReader(&conn), &Request{Method: "POST"})
+		if err != nil || string(resp.Body) != body {
+			t.Errorf("Response: expect %q, has %v - Test type: \033[31m%s\033[0m", body, err, tt.testContent)
+		}
+		conn.Close()
+		srv.Shutdown(context.Background())
+		<-errc
+	}
+}
+
+// newStreamRouter answers /stream with a first part flushed before next
+// is signaled, and /large with size bytes counted in written
+func newStreamRouter(next chan struct{}, written *int64, size int64) *Router {
+	router := NewRouter()
+	router.GET("/stream", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("first"))
+		w.(Flusher).Flush()
+		<-next
+		w.Write([]byte("second"))
+	})
+	router.GET("/large", func(w ResponseWriter, r *Request) {
+		chunk := make([]byte, 64<<10)
+		for atomic.LoadInt64(written) < size {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			atomic.AddInt64(written, int64(len(chunk)))
+		}
+	})
+	return router
+}
+
+func TestServerStreaming(t *testing.T) {
+	const size = 256 << 20
+	for _, tt := range shutdownModes {
+		next := make(chan struct{})
+		var written int64
+		srv := &Server{Router: newStreamRouter(next, &written, size), Config: ServerConfig{Mode: tt.mode}}
+		url, errc := startServer(t, srv)
+		port, _ := strconv.Atoi(url[len("http://127.0.0.1:"):])
+
+		conn, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadTimeout(2 * time.Second)
+		// The flushed part is received while the handler runs
+		conn.Write([]byte("GET /stream HTTP/1.1\r\n\r\n"))
+		var received string
+		buf := make([]byte, 4096)
+		for !strings.Contains(received, "first") {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("Read: expect the flushed part, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			}
+			received += string(buf[:n])
+		}
+		close(next)
+		for !strings.Contains(received, "second") {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("Read: expect the end of the response, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			}
+			received += string(buf[:n])
+		}
+
+		// A client not reading stops the handler instead of buffering the response
+		conn.Write([]byte("GET /large HTTP/1.1\r\n\r\n"))
+		time.Sleep(300 * time.Millisecond)
+		if n := atomic.LoadInt64(&written); n >= size {
+			t.Errorf("Written: expect the handler blocked, has %d bytes - Test type: \033[31m%s\033[0m", n, tt.testContent)
+		}
+		conn.Close()
+		srv.Shutdown(context.Background())
+		<-errc
+	}
+}
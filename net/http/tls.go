@@ -0,0 +1,175 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is the minimum time between two checks of the
+// modification of the certificate files
+var certCheckInterval = time.Second
+
+// keyPair is a certificate loaded from files
+type keyPair struct {
+	certFile, keyFile string
+	cert              *tls.Certificate
+	modTime           time.Time // latest modification time of the files
+	checked           time.Time // last check of the files
+}
+
+// filesModTime returns the latest modification time of the files of kp
+func (kp *keyPair) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{kp.certFile, kp.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load reads the certificate and the key of kp
+func (kp *keyPair) load() error {
+	modTime, err := kp.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	kp.cert = &cert
+	kp.modTime = modTime
+	return nil
+}
+
+// reload loads the files again if they have been modified since the last
+// load, the previous certificate is kept if the new files are invalid
+func (kp *keyPair) reload(now time.Time) {
+	if now.Sub(kp.checked) < certCheckInterval {
+		return
+	}
+	kp.checked = now
+	modTime, err := kp.filesModTime()
+	if err != nil || modTime.Equal(kp.modTime) {
+		return
+	}
+	if err = kp.load(); err != nil {
+		fmt.Println("Reload certificate:", err)
+	}
+}
+
+// CertReloader gives the certificates of key pair files to the TLS
+// handshakes: the certificate is selected by the server name sent by the
+// client (SNI) and the files modified on disk are loaded again without
+// restarting the server. It is safe for concurrent use.
+type CertReloader struct {
+	mu    sync.Mutex
+	pairs []*keyPair
+}
+
+// NewCertReloader returns a CertReloader without certificate
+func NewCertReloader() *CertReloader {
+	return &CertReloader{}
+}
+
+// Add loads the PEM encoded certificate chain and private key files, the
+// first certificate added is the default one
+func (cr *CertReloader) Add(certFile, keyFile string) error {
+	kp := &keyPair{certFile: certFile, keyFile: keyFile, checked: time.Now()}
+	if err := kp.load(); err != nil {
+		return err
+	}
+	cr.mu.Lock()
+	cr.pairs = append(cr.pairs, kp)
+	cr.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the first certificate valid for the server name
+// and the algorithms of the client, the default certificate if none is,
+// it is used as tls.Config.GetCertificate
+func (cr *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if len(cr.pairs) == 0 {
+		return nil, errors.New("http: no certificate")
+	}
+	now := time.Now()
+	for _, kp := range cr.pairs {
+		kp.reload(now)
+	}
+	if hello.ServerName != "" {
+		for _, kp := range cr.pairs {
+			if hello.SupportsCertificate(kp.cert) == nil {
+				return kp.cert, nil
+			}
+		}
+	}
+	return cr.pairs[0].cert, nil
+}
+
+// serverTLSConfig returns a copy of config completed with the defaults of
+// the server: TLS 1.2 at least, "http/1.1" advertised with ALPN and the
+// certificate of certFile and keyFile reloaded when modified
+func serverTLSConfig(config *tls.Config, certFile, keyFile string) (*tls.Config, error) {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if len(config.NextProtos) == 0 {
+		// * Only HTTP/1.1 is served - RFC 7301
+		config.NextProtos = []string{"http/1.1"}
+	}
+	if certFile != "" || keyFile != "" {
+		if config.GetCertificate != nil {
+			return nil, errors.New("http: both certificate files and GetCertificate given")
+		}
+		reloader := NewCertReloader()
+		if err := reloader.Add(certFile, keyFile); err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		return nil, errors.New("http: no certificate given for TLS")
+	}
+	return config, nil
+}
+
+// ListenAndServeTLS listens on srv.Addr and serves the connections over
+// TLS with the certificate chain and the private key of the PEM files,
+// they can be empty if srv.TLSConfig gives the certificates. The TLS
+// connections are always served in ModeGoroutine.
+func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	config, err := serverTLSConfig(srv.TLSConfig, certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	return srv.listenAndServe(config)
+}
+
+// ListenAndServeTLS will launch the server over TLS on the address
+// "host:port" with the certificate and the key of the PEM files
+func ListenAndServeTLS(addr, certFile, keyFile string, router *Router) error {
+	srv := &Server{Addr: addr, Router: router}
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
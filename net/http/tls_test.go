@@ -0,0 +1,342 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"../../net"
+	"../../tlsutil"
+)
+
+// testCA is a certificate authority signing the certificates of the tests
+type testCA struct {
+	*tlsutil.Cert
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	ca, err := tlsutil.NewCA("Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{Cert: ca, pool: ca.CertPool()}
+}
+
+// writeCert writes in dir the files name.crt and name.key of a
+// certificate for host and 127.0.0.1 signed by ca, it returns the file
+// names
+func (ca *testCA) writeCert(t *testing.T, dir, name, host string) (string, string) {
+	cert, err := ca.Issue([]string{host, "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err = cert.WriteFiles(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// tlsGet sends a GET request for path over a TLS connection to url
+func tlsGet(url, path string, config *tls.Config) (*Response, *tls.ConnectionState, error) {
+	port, _ := strconv.Atoi(url[strings.LastIndex(url, ":")+1:])
+	conn, err := net.Connect(net.IP{127, 0, 0, 1}, port)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	conn.SetReadTimeout(2 * time.Second)
+	tc := tls.Client(&conn, config)
+	if err = tc.Handshake(); err != nil {
+		return nil, nil, err
+	}
+	state := tc.ConnectionState()
+	if _, err = tc.Write([]byte("GET " + path + " HTTP/1.1\r\nConnection: close\r\n\r\n")); err != nil {
+		return nil, &state, err
+	}
+	resp, err := readResponse(newConnReader(tc), &Request{Method: "GET"})
+	return resp, &state, err
+}
+
+// startTLSServer runs srv over TLS with the files on a free local port
+func startTLSServer(t *testing.T, srv *Server, certFile, keyFile string) (string, chan error) {
+	return startServerWith(t, srv, func() error { return srv.ListenAndServeTLS(certFile, keyFile) })
+}
+
+func stopServer(t *testing.T, srv *Server, errc chan error) {
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	<-errc
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeCert(t, dir, "server", "a.test")
+
+	router := newPoolRouter()
+	router.GET("/tls", func(w ResponseWriter, r *Request) {
+		if r.TLS == nil || !r.TLS.HandshakeComplete {
+			w.Write([]byte("no tls"))
+			return
+		}
+		w.Write([]byte(r.TLS.ServerName + " " + r.TLS.NegotiatedProtocol))
+	})
+	srv := &Server{Router: router}
+	url, errc := startTLSServer(t, srv, certFile, keyFile)
+	defer stopServer(t, srv, errc)
+
+	tests := []struct {
+		path        string      // requested path
+		config      *tls.Config // configuration of the client
+		body        string      // expected body, empty for an error
+		testContent string      // test details
+	}{
+		{"/hello", &tls.Config{RootCAs: ca.pool, ServerName: "a.test"}, "hello", "Simple GET"},
+		{"/tls", &tls.Config{RootCAs: ca.pool, ServerName: "a.test", NextProtos: []string{"h2", "http/1.1"}}, "a.test http/1.1", "ALPN and SNI in the request"},
+		{"/tls", &tls.Config{RootCAs: ca.pool, ServerName: "a.test"}, "a.test ", "No ALPN"},
+		{"/hello", &tls.Config{RootCAs: ca.pool, ServerName: "a.test", NextProtos: []string{"h2"}}, "", "No common protocol"},
+		{"/hello", &tls.Config{RootCAs: ca.pool, ServerName: "a.test", MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}, "", "TLS 1.1 refused"},
+		{"/hello", &tls.Config{RootCAs: x509.NewCertPool(), ServerName: "a.test"}, "", "Unknown authority"},
+	}
+	for _, tt := range tests {
+		resp, _, err := tlsGet(url, tt.path, tt.config)
+		if tt.body == "" {
+			if err == nil {
+				t.Errorf("tlsGet: expect an error, has %q - Test type: \033[31m%s\033[0m", resp.Body, tt.testContent)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tlsGet: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			continue
+		}
+		if string(resp.Body) != tt.body {
+			t.Errorf("Body: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.body, resp.Body, tt.testContent)
+		}
+	}
+}
+
+func TestListenAndServeTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certA, keyA := ca.writeCert(t, dir, "a", "a.test")
+	certB, keyB := ca.writeCert(t, dir, "b", "b.test")
+	reloader := NewCertReloader()
+	for _, files := range [][2]string{{certA, keyA}, {certB, keyB}} {
+		if err := reloader.Add(files[0], files[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := &Server{Router: newPoolRouter(), TLSConfig: &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS13,
+	}}
+	url, errc := startTLSServer(t, srv, "", "")
+	defer stopServer(t, srv, errc)
+
+	tests := []struct {
+		serverName  string // SNI of the client
+		maxVersion  uint16 // maximum TLS version of the client
+		expectName  string // common name of the certificate, empty for an error
+		testContent string // test details
+	}{
+		{"a.test", 0, "a.test", "First certificate"},
+		{"b.test", 0, "b.test", "Second certificate"},
+		{"b.test", tls.VersionTLS12, "", "TLS 1.2 refused by MinVersion"},
+	}
+	for _, tt := range tests {
+		config := &tls.Config{RootCAs: ca.pool, ServerName: tt.serverName, MaxVersion: tt.maxVersion}
+		_, state, err := tlsGet(url, "/hello", config)
+		if tt.expectName == "" {
+			if err == nil {
+				t.Errorf("tlsGet: expect an error - Test type: \033[31m%s\033[0m", tt.testContent)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tlsGet: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			continue
+		}
+		if name := state.PeerCertificates[0].Subject.CommonName; name != tt.expectName {
+			t.Errorf("Certificate: expect %s, has %s - Test type: \033[31m%s\033[0m", tt.expectName, name, tt.testContent)
+		}
+	}
+
+	// Without SNI the first certificate is used
+	config := &tls.Config{RootCAs: ca.pool, InsecureSkipVerify: true}
+	if _, state, err := tlsGet(url, "/hello", config); err != nil {
+		t.Errorf("tlsGet without SNI: %v", err)
+	} else if name := state.PeerCertificates[0].Subject.CommonName; name != "a.test" {
+		t.Errorf("Default certificate: expect a.test, has %s", name)
+	}
+}
+
+func TestListenAndServeTLSErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	if err := (&Server{Addr: "127.0.0.1:0"}).ListenAndServeTLS(missing, missing); err == nil {
+		t.Error("Missing files: expect an error")
+	}
+	if err := (&Server{Addr: "127.0.0.1:0"}).ListenAndServeTLS("", ""); err == nil {
+		t.Error("No certificate: expect an error")
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	defer func(interval time.Duration) { certCheckInterval = interval }(certCheckInterval)
+	certCheckInterval = 0
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeCert(t, dir, "server", "old.test")
+	srv := &Server{Router: newPoolRouter()}
+	url, errc := startTLSServer(t, srv, certFile, keyFile)
+	defer stopServer(t, srv, errc)
+
+	config := &tls.Config{RootCAs: ca.pool, ServerName: "new.test", InsecureSkipVerify: true}
+	commonName := func() string {
+		_, state, err := tlsGet(url, "/hello", config)
+		if err != nil {
+			t.Fatalf("tlsGet: %v", err)
+		}
+		return state.PeerCertificates[0].Subject.CommonName
+	}
+	if name := commonName(); name != "old.test" {
+		t.Errorf("Before reload: expect old.test, has %s", name)
+	}
+
+	// An invalid file keeps the previous certificate
+	later := time.Now().Add(time.Minute)
+	os.WriteFile(keyFile, []byte("invalid"), 0600)
+	os.Chtimes(keyFile, later, later)
+	if name := commonName(); name != "old.test" {
+		t.Errorf("Invalid files: expect old.test, has %s", name)
+	}
+
+	ca.writeCert(t, dir, "server", "new.test")
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if name := commonName(); name != "new.test" {
+		t.Errorf("After reload: expect new.test, has %s", name)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeCert(t, dir, "server", "localhost")
+	router := newPoolRouter()
+	router.GET("/sni", func(w ResponseWriter, r *Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	})
+	srv := &Server{Router: router}
+	url, errc := startTLSServer(t, srv, certFile, keyFile)
+	defer stopServer(t, srv, errc)
+	port := url[strings.LastIndex(url, ":")+1:]
+
+	c := &Client{TLSConfig: &tls.Config{RootCAs: ca.pool}}
+	defer c.CloseIdleConnections()
+	tests := []struct {
+		url         string // requested URL
+		body        string // expected body
+		testContent string // test details
+	}{
+		{"https://localhost:" + port + "/sni", "localhost", "SNI from the host"},
+		{"https://localhost:" + port + "/hello", "hello", "Connection reused"},
+		{"https://127.0.0.1:" + port + "/sni", "", "No SNI for an IP address"},
+	}
+	for _, tt := range tests {
+		resp := get(t, c, tt.url)
+		if string(resp.Body) != tt.body {
+			t.Errorf("Body: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.body, resp.Body, tt.testContent)
+		}
+		if resp.TLS == nil {
+			t.Errorf("TLS: expect the connection state - Test type: \033[31m%s\033[0m", tt.testContent)
+			continue
+		}
+		if resp.TLS.NegotiatedProtocol != "http/1.1" {
+			t.Errorf("NegotiatedProtocol: expect http/1.1, has %q - Test type: \033[31m%s\033[0m", resp.TLS.NegotiatedProtocol, tt.testContent)
+		}
+		if name := resp.TLS.PeerCertificates[0].Subject.CommonName; name != "localhost" {
+			t.Errorf("Certificate: expect localhost, has %s - Test type: \033[31m%s\033[0m", name, tt.testContent)
+		}
+	}
+	c.mu.Lock()
+	idle := c.idleCount
+	c.mu.Unlock()
+	if idle != 2 {
+		t.Errorf("Idle connections: expect 2, has %d", idle)
+	}
+
+	// The server is not trusted by the system pool
+	req, _ := NewRequest("GET", url[len("http://"):]+"/hello", nil)
+	req.URL.Scheme = "https"
+	if _, err := (&Client{}).Do(&req); err == nil {
+		t.Error("Unknown authority: expect an error")
+	}
+	// The plain HTTP client cannot read a TLS server
+	req, _ = NewRequest("GET", url+"/hello", nil)
+	if _, err := (&Client{}).Do(&req); err == nil {
+		t.Error("http on a TLS server: expect an error")
+	}
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.writeCert(t, dir, "server", "localhost")
+	clientCertFile, clientKeyFile := ca.writeCert(t, dir, "client", "client.test")
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newPoolRouter()
+	router.GET("/whoami", func(w ResponseWriter, r *Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	})
+	srv := &Server{Router: router, TLSConfig: &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  ca.pool,
+	}}
+	url, errc := startTLSServer(t, srv, certFile, keyFile)
+	defer stopServer(t, srv, errc)
+	target := "https://localhost:" + url[strings.LastIndex(url, ":")+1:] + "/whoami"
+
+	tests := []struct {
+		config      *tls.Config // configuration of the client
+		body        string      // expected body, empty for an error
+		testContent string      // test details
+	}{
+		{&tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{clientCert}}, "client.test", "Client certificate"},
+		{&tls.Config{RootCAs: ca.pool}, "", "No client certificate"},
+	}
+	for _, tt := range tests {
+		c := &Client{TLSConfig: tt.config}
+		req, _ := NewRequest("GET", target, nil)
+		resp, err := c.Do(&req)
+		c.CloseIdleConnections()
+		if tt.body == "" {
+			if err == nil {
+				t.Errorf("Do: expect an error, has %q - Test type: \033[31m%s\033[0m", resp.Body, tt.testContent)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Do: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			continue
+		}
+		if string(resp.Body) != tt.body {
+			t.Errorf("Body: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.body, resp.Body, tt.testContent)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package http
+
+import "strings"
+
+// Param is a url parameter extracted by the router
+type Param struct {
+	Key   string
+	Value string
+}
+
+// node is a node of the radix tree storing the routes by url pattern
+// A pattern is made of static parts and of segments starting with:
+// - ':' matching a named parameter until the next '/', like "/users/:id"
+// - '*' matching the rest of the url, like "/static/*path"
+// Static parts have precedence over parameters, then over catch-all
+// segments, whatever the order of the routes creation.
+type node struct {
+	prefix   string  // static part of the url, parameter name otherwise
+	children []*node // static children, each starting with a different byte
+	param    *node
+	catchAll *node
+
+	routes map[string]Route // method -> route
+}
+
+// nextParam returns the index of the next parameter segment of a pattern,
+// len(pattern) if there is none
+func nextParam(pattern string) int {
+	for i := 1; i < len(pattern); i++ {
+		if (pattern[i] == ':' || pattern[i] == '*') && pattern[i-1] == '/' {
+			return i
+		}
+	}
+	return len(pattern)
+}
+
+func commonPrefixLength(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// insert returns the node of the given pattern, creating the missing ones
+func (n *node) insert(pattern string) *node {
+	if pattern == "" {
+		return n
+	}
+	switch pattern[0] {
+	case ':':
+		end := strings.IndexByte(pattern, '/')
+		if end == -1 {
+			end = len(pattern)
+		}
+		name := pattern[1:end]
+		if name == "" {
+			panic("http: empty parameter name in route")
+		}
+		if n.param == nil {
+			n.param = &node{prefix: name}
+		} else if n.param.prefix != name {
+			panic("http: parameter :" + name + " conflicts with :" + n.param.prefix)
+		}
+		return n.param.insert(pattern[end:])
+	case '*':
+		name := pattern[1:]
+		if name == "" || strings.Contains(name, "/") {
+			panic("http: catch-all segment must be named and end the route")
+		}
+		if n.catchAll == nil {
+			n.catchAll = &node{prefix: name}
+		} else if n.catchAll.prefix != name {
+			panic("http: catch-all *" + name + " conflicts with *" + n.catchAll.prefix)
+		}
+		return n.catchAll
+	}
+
+	static := pattern[:nextParam(pattern)]
+	for i, child := range n.children {
+		l := commonPrefixLength(child.prefix, static)
+		if l == 0 {
+			continue
+		}
+		// Split the child keeping the common prefix as a new parent
+		if l < len(child.prefix) {
+			parent := &node{prefix: child.prefix[:l]}
+			child.prefix = child.prefix[l:]
+			parent.children = []*node{child}
+			n.children[i] = parent
+			child = parent
+		}
+		return child.insert(pattern[l:])
+	}
+	child := &node{prefix: static}
+	n.children = append(n.children, child)
+	return child.insert(pattern[len(static):])
+}
+
+// match returns the node with routes matching path and appends the
+// parameters found to params, nil if no node matches
+func (n *node) match(path string, params *[]Param) *node {
+	if path == "" && n.routes != nil {
+		return n
+	}
+	for _, child := range n.children {
+		if strings.HasPrefix(path, child.prefix) {
+			if found := child.match(path[len(child.prefix):], params); found != nil {
+				return found
+			}
+			break
+		}
+	}
+	if n.param != nil {
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+		if end > 0 {
+			*params = append(*params, Param{Key: n.param.prefix, Value: path[:end]})
+			if found := n.param.match(path[end:], params); found != nil {
+				return found
+			}
+			*params = (*params)[:len(*params)-1]
+		}
+	}
+	if n.catchAll != nil && n.catchAll.routes != nil {
+		*params = append(*params, Param{Key: n.catchAll.prefix, Value: path})
+		return n.catchAll
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Uniform Resource Identifier (URI): Generic Syntax
+// https://tools.ietf.org/html/rfc3986
+
+// URL is the structure where the components of a parsed URL are stored
+// scheme://user@host:port/path?query#fragment
+type URL struct {
+	Scheme   string
+	User     string // userinfo, like "user:password"
+	Host     string // without the brackets of an IPv6 address
+	Port     string
+	Path     string // decoded path, dot-segments removed
+	RawPath  string // encoded path, dot-segments removed
+	RawQuery string // encoded query, without '?'
+	Fragment string // decoded fragment, without '#'
+}
+
+// EscapeError is returned when a percent-encoded sequence is invalid
+type EscapeError string
+
+func (e EscapeError) Error() string {
+	return "invalid URL escape " + strconv.Quote(string(e))
+}
+
+type encoding int
+
+const (
+	encodePath encoding = iota + 1
+	encodeQueryComponent
+	encodeFragment
+)
+
+const upperhex = "0123456789ABCDEF"
+
+func ishex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+// isUnreserved returns true for the characters never escaped
+// unreserved = ALPHA / DIGIT / "-" / "." / "_" / "~"
+func isUnreserved(c byte) bool {
+	if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+		return true
+	}
+	return c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// shouldEscape returns true if c must be percent-encoded in the
+// component given by mode
+func shouldEscape(c byte, mode encoding) bool {
+	if isUnreserved(c) {
+		return false
+	}
+	switch c {
+	// sub-delims, ':' and '@' are allowed in a path segment - RFC 3986, 3.3
+	case '!', '$', '&', '\'', '(', ')', '*', '+', ',', ';', '=', ':', '@', '/':
+		return mode == encodeQueryComponent
+	case '?':
+		return mode != encodeFragment
+	}
+	return true
+}
+
+func escape(s string, mode encoding) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' && mode == encodeQueryComponent:
+			buf.WriteByte('+')
+		case shouldEscape(c, mode):
+			buf.WriteByte('%')
+			buf.WriteByte(upperhex[c>>4])
+			buf.WriteByte(upperhex[c&15])
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func unescape(s string, mode encoding) (string, error) {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '%':
+			if i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
+				end := i + 3
+				if end > len(s) {
+					end = len(s)
+				}
+				return "", EscapeError(s[i:end])
+			}
+			buf.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case '+':
+			if mode == encodeQueryComponent {
+				buf.WriteByte(' ')
+			} else {
+				buf.WriteByte('+')
+			}
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String(), nil
+}
+
+// PathEscape escapes s to be used as a URL path, '/' is kept
+func PathEscape(s string) string { return escape(s, encodePath) }
+
+// PathUnescape decodes the percent-encoded sequences of a URL path
+func PathUnescape(s string) (string, error) { return unescape(s, encodePath) }
+
+// QueryEscape escapes s to be used as a name or a value of a URL query
+func QueryEscape(s string) string { return escape(s, encodeQueryComponent) }
+
+// QueryUnescape decodes a name or a value of a URL query, '+' being
+// decoded as a space
+func QueryUnescape(s string) (string, error) { return unescape(s, encodeQueryComponent) }
+
+// normalizeEscapes uppercases the hexadecimal digits of the
+// percent-encoded sequences and decodes the unreserved characters
+// - RFC 3986, 6.2.2.1 and 6.2.2.2
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteByte('%')
+				buf.WriteByte(upperhex[c>>4])
+				buf.WriteByte(upperhex[c&15])
+			}
+			i += 2
+			continue
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// removeDotSegments resolves the "." and ".." segments of an absolute
+// path - RFC 3986, 5.2.4
+func removeDotSegments(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	// The first empty segment is the root, it is never removed
+	out := []string{""}
+	for i, segment := range segments[1:] {
+		switch segment {
+		case ".":
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, segment)
+			continue
+		}
+		// A path ending with a dot-segment ends with a '/'
+		if i == len(segments)-2 {
+			out = append(out, "")
+		}
+	}
+	if len(out) == 1 {
+		return "/"
+	}
+	return strings.Join(out, "/")
+}
+
+// getScheme splits the scheme from the rest of a URL if there is one
+// scheme = ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func getScheme(raw string) (scheme, rest string) {
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+		case ('0' <= c && c <= '9') || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return "", raw
+			}
+		case c == ':' && i > 0:
+			return raw[:i], raw[i+1:]
+		default:
+			return "", raw
+		}
+	}
+	return "", raw
+}
+
+// parseAuthority stores the userinfo, the host and the port of a URL
+// authority = [ userinfo "@" ] host [ ":" port ]
+func (u *URL) parseAuthority(authority string) error {
+	if i := strings.LastIndexByte(authority, '@'); i != -1 {
+		u.User = authority[:i]
+		authority = authority[i+1:]
+	}
+	host := authority
+	port := ""
+	if strings.HasPrefix(authority, "[") {
+		end := strings.IndexByte(authority, ']')
+		if end == -1 {
+			return errors.New("missing ']' in host")
+		}
+		host = authority[1:end]
+		if rest := authority[end+1:]; rest != "" {
+			if rest[0] != ':' {
+				return errors.New("invalid character after ']' in host")
+			}
+			port = rest[1:]
+		}
+	} else if i := strings.LastIndexByte(authority, ':'); i != -1 {
+		host = authority[:i]
+		port = authority[i+1:]
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return errors.New("invalid port " + strconv.Quote(port))
+		}
+	}
+	u.Host = strings.ToLower(host)
+	u.Port = port
+	return nil
+}
+
+// setPath stores the normalized path of a URL
+func (u *URL) setPath(raw string) error {
+	raw = removeDotSegments(normalizeEscapes(raw))
+	path, err := PathUnescape(raw)
+	if err != nil {
+		return err
+	}
+	u.Path = path
+	u.RawPath = raw
+	return nil
+}
+
+// ParseURL parses a URL, absolute or only made of a path, and returns
+// its components
+func ParseURL(raw string) (*URL, error) {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] <= ' ' || raw[i] == 0x7f {
+			return nil, errors.New("invalid character in URL " + strconv.Quote(raw))
+		}
+	}
+	u := &URL{}
+	// asterisk-form of OPTIONS requests - RFC 7230, 5.3.4
+	if raw == "*" {
+		u.Path, u.RawPath = raw, raw
+		return u, nil
+	}
+	rest := raw
+	if i := strings.IndexByte(rest, '#'); i != -1 {
+		fragment, err := unescape(rest[i+1:], encodeFragment)
+		if err != nil {
+			return nil, err
+		}
+		u.Fragment = fragment
+		rest = rest[:i]
+	}
+	if i := strings.IndexByte(rest, '?'); i != -1 {
+		u.RawQuery = rest[i+1:]
+		rest = rest[:i]
+	}
+	var scheme string
+	scheme, rest = getScheme(rest)
+	u.Scheme = strings.ToLower(scheme)
+	if strings.HasPrefix(rest, "//") {
+		authority := rest[2:]
+		end := strings.IndexByte(authority, '/')
+		if end == -1 {
+			end = len(authority)
+		}
+		rest = authority[end:]
+		if err := u.parseAuthority(authority[:end]); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.setPath(rest); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Parse parses ref in the context of u, ref being an absolute or a
+// relative reference like the value of a Location header - RFC 3986, 5.2
+func (u *URL) Parse(ref string) (*URL, error) {
+	r, err := ParseURL(ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.Scheme != "" {
+		return r, nil
+	}
+	r.Scheme = u.Scheme
+	if strings.HasPrefix(ref, "//") {
+		return r, nil
+	}
+	r.User, r.Host, r.Port = u.User, u.Host, u.Port
+	switch {
+	case r.RawPath == "":
+		r.Path, r.RawPath = u.Path, u.RawPath
+		if !strings.Contains(ref, "?") {
+			r.RawQuery = u.RawQuery
+		}
+	case r.RawPath[0] != '/':
+		// Merge the relative path with the directory of the base path
+		base := u.RawPath
+		if i := strings.LastIndexByte(base, '/'); i != -1 {
+			base = base[:i+1]
+		} else {
+			base = "/"
+		}
+		if err := r.setPath(base + r.RawPath); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// EscapedPath returns the encoded path of the URL
+func (u *URL) EscapedPath() string {
+	if u.RawPath != "" {
+		if path, err := PathUnescape(u.RawPath); err == nil && path == u.Path {
+			return u.RawPath
+		}
+	}
+	return PathEscape(u.Path)
+}
+
+// RequestURI returns the encoded path and query sent in a request line
+func (u *URL) RequestURI() string {
+	uri := u.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	if u.RawQuery != "" {
+		uri += "?" + u.RawQuery
+	}
+	return uri
+}
+
+// HostPort returns the host and the port of the URL as used in the
+// Host header, the port is omitted if not set
+func (u *URL) HostPort() string {
+	host := u.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if u.Port != "" {
+		host += ":" + u.Port
+	}
+	return host
+}
+
+// String returns the encoded URL
+func (u *URL) String() string {
+	var buf strings.Builder
+	if u.Scheme != "" {
+		buf.WriteString(u.Scheme + ":")
+	}
+	if u.Host != "" || u.User != "" {
+		buf.WriteString("//")
+		if u.User != "" {
+			buf.WriteString(u.User + "@")
+		}
+		buf.WriteString(u.HostPort())
+	}
+	path := u.EscapedPath()
+	if path != "" && path[0] != '/' && u.Host != "" {
+		buf.WriteByte('/')
+	}
+	buf.WriteString(path)
+	if u.RawQuery != "" {
+		buf.WriteString("?" + u.RawQuery)
+	}
+	if u.Fragment != "" {
+		buf.WriteString("#" + escape(u.Fragment, encodeFragment))
+	}
+	return buf.String()
+}
+
+// Query returns the values of the URL query
+func (u *URL) Query() Values {
+	return ParseQuery(u.RawQuery)
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// URL Living Standard - https://url.spec.whatwg.org/#urlencoded-parsing
+
+// Values store the URL values from the queries and the forms
+type Values map[string][]string
+
+// AddValue append a new item to a given key in Values
+func (v *Values) AddValue(key, value string) {
+	(*v)[key] = append((*v)[key], value)
+}
+
+// Get returns the first value of key, "" if there is none
+func (v Values) Get(key string) string {
+	if values := v[key]; len(values) != 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Set replaces the values of key by value
+func (v Values) Set(key, value string) {
+	v[key] = []string{value}
+}
+
+// Del removes the values of key
+func (v Values) Del(key string) {
+	delete(v, key)
+}
+
+// Encode returns the values serialized in the
+// application/x-www-form-urlencoded format, sorted by key
+func (v Values) Encode() string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, key := range keys {
+		for _, value := range v[key] {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(formEscape(key) + "=" + formEscape(value))
+		}
+	}
+	return buf.String()
+}
+
+// ParseQuery parses a URL query or an application/x-www-form-urlencoded
+// body, it never fails:
+// - the sequences without '=' are names with an empty value
+// - '+' is decoded as a space and the invalid percent-encoded sequences
+// are kept as they are
+// - the invalid UTF-8 bytes are replaced by U+FFFD
+func ParseQuery(query string) Values {
+	values := Values{}
+	for _, sequence := range strings.Split(query, "&") {
+		if sequence == "" {
+			continue
+		}
+		name, value := sequence, ""
+		if i := strings.IndexByte(sequence, '='); i != -1 {
+			name, value = sequence[:i], sequence[i+1:]
+		}
+		values.AddValue(formUnescape(name), formUnescape(value))
+	}
+	return values
+}
+
+// formUnescape replaces '+' by a space, decodes the valid percent-encoded
+// sequences and the result as UTF-8
+func formUnescape(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '+':
+			buf.WriteByte(' ')
+		case s[i] == '%' && i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2]):
+			buf.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	decoded := buf.String()
+	if utf8.ValidString(decoded) {
+		return decoded
+	}
+	buf.Reset()
+	for len(decoded) > 0 {
+		r, size := utf8.DecodeRuneInString(decoded)
+		buf.WriteRune(r) // utf8.RuneError is U+FFFD
+		decoded = decoded[size:]
+	}
+	return buf.String()
+}
+
+// formEscape percent-encodes every byte except the ASCII alphanumerics
+// and "*-._", a space is encoded as '+'
+func formEscape(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9'),
+			c == '*', c == '-', c == '.', c == '_':
+			buf.WriteByte(c)
+		case c == ' ':
+			buf.WriteByte('+')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(upperhex[c>>4])
+			buf.WriteByte(upperhex[c&15])
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var parseQueryTests = []struct {
+	query       string // input
+	expected    Values // expected result
+	testContent string // test details
+}{
+	{"a=b%20c", Values{"a": {"b c"}}, "Percent-encoded space"},
+	{"a=b+c&a=d", Values{"a": {"b c", "d"}}, "Plus and repeated name"},
+	{"a=b=c", Values{"a": {"b=c"}}, "'=' in the value"},
+	{"flag&a=", Values{"flag": {""}, "a": {""}}, "Names without value"},
+	{"&&a=1&&", Values{"a": {"1"}}, "Empty sequences"},
+	{"=value", Values{"": {"value"}}, "Empty name"},
+	{"a=%zz&b=%4", Values{"a": {"%zz"}, "b": {"%4"}}, "Invalid percent sequences kept"},
+	{"a=%2B", Values{"a": {"+"}}, "Encoded plus"},
+	{"%C3%A9t%C3%A9=summer", Values{"été": {"summer"}}, "UTF-8 name"},
+	{"a=%FF", Values{"a": {"�"}}, "Invalid UTF-8"},
+	{"", Values{}, "Empty query"},
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, tt := range parseQueryTests {
+		if diff := pretty.Compare(ParseQuery(tt.query), tt.expected); diff != "" {
+			t.Errorf("ParseQuery(%s): %s - Test type: \033[31m%s\033[0m", tt.query, diff, tt.testContent)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	v := Values{}
+	v.Set("name", "Ava Lovelace")
+	v.AddValue("lang", "go")
+	v.AddValue("lang", "c++")
+	v.Set("tilde", "~*-._")
+	v.Set("gone", "1")
+	v.Del("gone")
+	if actual := v.Get("lang"); actual != "go" {
+		t.Errorf("Get: expect go, has %s", actual)
+	}
+	if actual := v.Get("gone"); actual != "" {
+		t.Errorf("Get: expect empty value, has %s", actual)
+	}
+	expected := "lang=go&lang=c%2B%2B&name=Ava+Lovelace&tilde=%7E*-._"
+	if actual := v.Encode(); actual != expected {
+		t.Errorf("Encode: expect %s, has %s", expected, actual)
+	}
+}
+
+func FuzzParseQuery(f *testing.F) {
+	for _, tt := range parseQueryTests {
+		f.Add(tt.query)
+	}
+	f.Add("a=%%%&&=&+=+%2")
+	f.Fuzz(func(t *testing.T, query string) {
+		values := ParseQuery(query)
+		for name, list := range values {
+			for _, value := range list {
+				if !utf8.ValidString(name) || !utf8.ValidString(value) {
+					t.Fatalf("ParseQuery(%q): invalid UTF-8 in %q=%q", query, name, value)
+				}
+			}
+		}
+		// Serializing then parsing again must give the same values
+		encoded := values.Encode()
+		if diff := pretty.Compare(ParseQuery(encoded), values); diff != "" {
+			t.Fatalf("ParseQuery(%q) then Encode %q: %s", query, encoded, diff)
+		}
+	})
+}
@@ -1,13 +1,26 @@
 package net
 
 import (
+	"fmt"
+	gonet "net"
 	"strconv"
 	"strings"
 )
 
-// IP is the IP format
+// IP is the IP format, 4 bytes for an IPv4 address and 16 bytes for an
+// IPv6 address
 type IP []byte
 
+// Length of the IP addresses in bytes
+const (
+	IPv4len = 4
+	IPv6len = 16
+)
+
+// v4InV6Prefix is the prefix of the IPv4-mapped IPv6 addresses
+// ::ffff:0:0/96 - RFC 4291, 2.5.5.2
+var v4InV6Prefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
 func parseIPv4(s string) IP {
 	var ip [4]byte
 	bytesStr := strings.Split(s, ".")
@@ -24,16 +37,213 @@ func parseIPv4(s string) IP {
 	return IP{ip[0], ip[1], ip[2], ip[3]}
 }
 
+// parseIPv6 parses the text representation of an IPv6 address
+// - RFC 4291, 2.2: x:x:x:x:x:x:x:x, "::" for one or more groups of zeros
+// and x:x:x:x:x:x:d.d.d.d with an IPv4 address as the last 32 bits
+func parseIPv6(s string) IP {
+	ip := make(IP, IPv6len)
+	ellipsis := -1 // index of the groups replaced by "::"
+	if strings.HasPrefix(s, "::") {
+		ellipsis = 0
+		s = s[2:]
+		if s == "" {
+			return ip
+		}
+	}
+	i := 0
+	for i < IPv6len {
+		end := strings.IndexByte(s, ':')
+		if end == -1 {
+			end = len(s)
+		}
+		group := s[:end]
+		if strings.IndexByte(group, '.') != -1 {
+			// The IPv4 address ends the IPv6 address
+			if end != len(s) || i > IPv6len-IPv4len {
+				return nil
+			}
+			ip4 := parseIPv4(group)
+			if ip4 == nil {
+				return nil
+			}
+			copy(ip[i:], ip4)
+			i += IPv4len
+			s = ""
+			break
+		}
+		if len(group) == 0 || len(group) > 4 {
+			return nil
+		}
+		n, err := strconv.ParseUint(group, 16, 16)
+		if err != nil {
+			return nil
+		}
+		ip[i], ip[i+1] = byte(n>>8), byte(n)
+		i += 2
+		s = s[end:]
+		if s == "" {
+			break
+		}
+		// s starts with ':'
+		s = s[1:]
+		if s == "" {
+			return nil
+		}
+		if s[0] == ':' {
+			if ellipsis != -1 {
+				return nil
+			}
+			ellipsis = i
+			s = s[1:]
+			if s == "" {
+				break
+			}
+		}
+	}
+	if s != "" {
+		return nil
+	}
+	if i < IPv6len {
+		if ellipsis == -1 {
+			return nil
+		}
+		// Move the groups after "::" to the end of the address
+		n := IPv6len - i
+		copy(ip[ellipsis+n:], ip[ellipsis:i])
+		for j := ellipsis; j < ellipsis+n; j++ {
+			ip[j] = 0
+		}
+	} else if ellipsis != -1 {
+		// "::" must replace at least one group
+		return nil
+	}
+	return ip
+}
+
 // ParseIP parses a IP address and return the []byte result
 // If not a valid IP return nil
 // Handle:
-// - IPv4
+// - IPv4: 4 bytes
+// - IPv6, IPv4-mapped IPv6: 16 bytes
+// The addresses with a zone are rejected, see ParseIPZone
 func ParseIP(s string) IP {
 	for i := 0; i < len(s); i++ {
 		switch s[i] {
 		case '.':
 			return parseIPv4(s)
+		case ':':
+			return parseIPv6(s)
+		}
+	}
+	return nil
+}
+
+// ParseIPZone parses an IP address followed by an optional IPv6 zone
+// "fe80::1%eth0" - RFC 6874, the zone is "" if there is none
+func ParseIPZone(s string) (IP, string) {
+	zone := ""
+	if i := strings.LastIndexByte(s, '%'); i != -1 {
+		s, zone = s[:i], s[i+1:]
+		if zone == "" {
+			return nil, ""
 		}
 	}
+	ip := ParseIP(s)
+	if ip == nil || (zone != "" && len(ip) != IPv6len) {
+		return nil, ""
+	}
+	return ip, zone
+}
+
+// To4 returns the 4 bytes of an IPv4 or IPv4-mapped IPv6 address, nil if
+// ip is not one of them
+func (ip IP) To4() IP {
+	if len(ip) == IPv4len {
+		return ip
+	}
+	if len(ip) == IPv6len && string(ip[:12]) == string(v4InV6Prefix) {
+		return ip[12:16]
+	}
 	return nil
 }
+
+// To16 returns ip on 16 bytes, an IPv4 address is IPv4-mapped
+func (ip IP) To16() IP {
+	if len(ip) == IPv4len {
+		return append(append(IP{}, v4InV6Prefix...), ip...)
+	}
+	if len(ip) == IPv6len {
+		return ip
+	}
+	return nil
+}
+
+// String returns the text representation of ip, the IPv6 addresses are
+// in the canonical form of RFC 5952: lower case, the longest run of two
+// or more zero groups replaced by "::" and the IPv4-mapped addresses
+// ending with the IPv4 address
+func (ip IP) String() string {
+	switch len(ip) {
+	case IPv4len:
+		return fmt.Sprintf("%d.%d.%d.%d", ip[0], ip[1], ip[2], ip[3])
+	case IPv6len:
+	default:
+		return "?"
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	// Longest run of zero groups, the first one on equality
+	start, length := -1, 0
+	for i := 0; i < IPv6len; i += 2 {
+		j := i
+		for j < IPv6len && ip[j] == 0 && ip[j+1] == 0 {
+			j += 2
+		}
+		if j-i > length && j-i >= 4 {
+			start, length = i, j-i
+		}
+		if j > i {
+			i = j - 2
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < IPv6len; i += 2 {
+		if i == start {
+			b.WriteString("::")
+			i += length - 2
+			continue
+		}
+		if i > 0 && i != start+length {
+			b.WriteByte(':')
+		}
+		b.WriteString(strconv.FormatUint(uint64(ip[i])<<8|uint64(ip[i+1]), 16))
+	}
+	return b.String()
+}
+
+// LookupIP returns the addresses of host, the IPv4 addresses first, host
+// can be an IP address
+func LookupIP(host string) ([]IP, error) {
+	if ip := ParseIP(host); ip != nil {
+		return []IP{ip}, nil
+	}
+	// * The resolution of the names is left to the standard library
+	addrs, err := gonet.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	var ips, ips6 []IP
+	for _, addr := range addrs {
+		if ip4 := addr.To4(); ip4 != nil {
+			ips = append(ips, IP{ip4[0], ip4[1], ip4[2], ip4[3]})
+		} else if len(addr) == IPv6len {
+			ips6 = append(ips6, IP(append([]byte{}, addr...)))
+		}
+	}
+	ips = append(ips, ips6...)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP address found for %s", host)
+	}
+	return ips, nil
+}
@@ -12,6 +12,26 @@ var IP4Tests = []struct {
 }{
 	{"37.169.43.146", IP{37, 169, 43, 146}, "Valid IPv4"},
 	{"37.169.43146", nil, "Invalid IPv4"},
+	{"2001:db8:0:0:1:0:0:1", IP{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1}, "Valid IPv6"},
+	{"2001:DB8::1", IP{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "IPv6 compressed upper case"},
+	{"::", make(IP, 16), "IPv6 unspecified"},
+	{"::1", IP{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "IPv6 loopback"},
+	{"fe80::", IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "IPv6 compressed end"},
+	{"::ffff:192.0.2.1", IP{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 0, 2, 1}, "IPv4-mapped IPv6"},
+	{"1:2:3:4:5:6:7:8", IP{0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0, 7, 0, 8}, "IPv6 without compression"},
+	{"1:2:3:4:5:6:1.2.3.4", IP{0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 1, 2, 3, 4}, "IPv6 ending with IPv4"},
+	{"1:2:3:4:5:6:7:8:9", nil, "IPv6 too many groups"},
+	{"1:2:3:4:5:6:7", nil, "IPv6 too few groups"},
+	{"1:2:3:4:5:6:7:8::", nil, "IPv6 compression without zero"},
+	{"1::2::3", nil, "IPv6 two compressions"},
+	{":1:2", nil, "IPv6 single leading colon"},
+	{"1:2:", nil, "IPv6 single trailing colon"},
+	{"12345::1", nil, "IPv6 group too long"},
+	{"g::1", nil, "IPv6 invalid hex"},
+	{"::1.2.3", nil, "IPv6 invalid IPv4 end"},
+	{"1.2.3.4::", nil, "IPv4 before IPv6"},
+	{"fe80::1%eth0", nil, "IPv6 zone rejected"},
+	{"localhost", nil, "Not an IP"},
 }
 
 func TestParseIP(t *testing.T) {
@@ -23,3 +43,50 @@ func TestParseIP(t *testing.T) {
 		}
 	}
 }
+
+var IPZoneTests = []struct {
+	str         string // input
+	expected    IP     // expected IP
+	zone        string // expected zone
+	testContent string // test details
+}{
+	{"fe80::1%eth0", IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "eth0", "IPv6 with zone"},
+	{"fe80::1", IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, "", "IPv6 without zone"},
+	{"fe80::1%", nil, "", "Empty zone"},
+	{"127.0.0.1%eth0", nil, "", "IPv4 with zone"},
+}
+
+func TestParseIPZone(t *testing.T) {
+	for _, tt := range IPZoneTests {
+		actual, zone := ParseIPZone(tt.str)
+		if !bytes.Equal(actual, tt.expected) || zone != tt.zone {
+			t.Errorf("ParseIPZone(%s): expect [% x] %q, has [% x] %q - Test type: \033[31m%s\033[0m",
+				tt.str, tt.expected, tt.zone, actual, zone, tt.testContent)
+		}
+	}
+}
+
+var IPStringTests = []struct {
+	str         string // input
+	expected    string // expected result
+	testContent string // test details
+}{
+	{"37.169.43.146", "37.169.43.146", "IPv4"},
+	{"2001:DB8:0:0:1:0:0:1", "2001:db8::1:0:0:1", "First longest zero run"},
+	{"2001:db8:0:0:0:0:2:1", "2001:db8::2:1", "Zero run compressed"},
+	{"2001:db8:0:1:1:1:1:1", "2001:db8:0:1:1:1:1:1", "Single zero group kept"},
+	{"2001:0:0:1:0:0:0:1", "2001:0:0:1::1", "Longest zero run"},
+	{"0:0:0:0:0:0:0:0", "::", "Unspecified"},
+	{"0:0:0:0:0:0:0:1", "::1", "Loopback"},
+	{"fe80:0:0:0:0:0:0:0", "fe80::", "Zero run at the end"},
+	{"::ffff:c000:201", "::ffff:192.0.2.1", "IPv4-mapped"},
+}
+
+func TestIPString(t *testing.T) {
+	for _, tt := range IPStringTests {
+		if actual := ParseIP(tt.str).String(); actual != tt.expected {
+			t.Errorf("String(%s): expect %s, has %s - Test type: \033[31m%s\033[0m",
+				tt.str, tt.expected, actual, tt.testContent)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package net
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultBacklog is the maximum number of connections waiting to be
+// accepted by a listening socket
+const DefaultBacklog = 100
+
+// ListenConfig contains the options of a listening socket and of the
+// connections it accepts. The zero value sets none of them.
+type ListenConfig struct {
+	// ReuseAddr sets SO_REUSEADDR: the port can be bound again while the
+	// connections of a previous server are in TIME_WAIT
+	ReuseAddr bool
+	// ReusePort sets SO_REUSEPORT: several processes can listen on the
+	// same port, the system shares the connections between them
+	ReusePort bool
+	// NoDelay sets TCP_NODELAY on the accepted connections, the data is
+	// sent without waiting to fill a segment
+	NoDelay bool
+	// KeepAlive is the idle time of an accepted connection before the
+	// first keepalive probe, the probes are disabled if 0
+	KeepAlive time.Duration
+	// KeepAliveInterval is the time between the probes and KeepAliveCount
+	// the number of probes unanswered before closing the connection, the
+	// system defaults are used if 0
+	KeepAliveInterval time.Duration
+	KeepAliveCount    int
+	// Backlog is the size of the queue of the connections waiting to be
+	// accepted, DefaultBacklog if 0
+	Backlog int
+	// CloseOnExec sets close-on-exec on the sockets so that they are not
+	// inherited by the processes executed
+	CloseOnExec bool
+}
+
+// DefaultListenConfig is the configuration of the servers
+var DefaultListenConfig = ListenConfig{
+	ReuseAddr:   true,
+	NoDelay:     true,
+	KeepAlive:   15 * time.Second,
+	CloseOnExec: true,
+}
+
+func (c ListenConfig) backlog() int {
+	if c.Backlog > 0 {
+		return c.Backlog
+	}
+	return DefaultBacklog
+}
+
+// setOptions sets the options of the listening socket, before bind
+func (s *TCPServer) setOptions(family int) error {
+	if family == unix.AF_INET6 {
+		// * The default of IPV6_V6ONLY depends on the system, it is
+		// disabled to receive the IPv4 connections as IPv4-mapped addresses
+		if err := unix.SetsockoptInt(s.Fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 0); err != nil {
+			return err
+		}
+	}
+	if s.config.ReuseAddr {
+		if err := unix.SetsockoptInt(s.Fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return err
+		}
+	}
+	if s.config.ReusePort {
+		if err := unix.SetsockoptInt(s.Fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seconds rounds d up to a whole number of seconds, the unit of the
+// keepalive options
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// setConnOptions sets the options of a connection accepted by s,
+// close-on-exec is set by acceptCloexec
+func (s *TCPServer) setConnOptions(fd int) error {
+	c := s.config
+	if c.NoDelay {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_NODELAY, 1); err != nil {
+			return err
+		}
+	}
+	if c.KeepAlive <= 0 {
+		return nil
+	}
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1); err != nil {
+		return err
+	}
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, tcpKeepIdle, seconds(c.KeepAlive)); err != nil {
+		return err
+	}
+	if c.KeepAliveInterval > 0 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, seconds(c.KeepAliveInterval)); err != nil {
+			return err
+		}
+	}
+	if c.KeepAliveCount > 0 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, c.KeepAliveCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ipv6Supported returns true if the system can create IPv6 sockets
+func ipv6Supported() bool {
+	fd, err := socketCloexec(unix.AF_INET6, true)
+	if err != nil {
+		return false
+	}
+	unix.Close(fd)
+	return true
+}
+
+// SplitHostPort splits an address "host:port", "[host]:port" for an IPv6
+// address, in its host and its port
+func SplitHostPort(address string) (string, int, error) {
+	i := strings.LastIndexByte(address, ':')
+	if i == -1 {
+		return "", 0, fmt.Errorf("%q: missing port in address", address)
+	}
+	host, portStr := address[:i], address[i+1:]
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return "", 0, fmt.Errorf("%q: missing ']' in address", address)
+		}
+		host = host[1 : len(host)-1]
+	} else if strings.IndexByte(host, ':') != -1 {
+		return "", 0, fmt.Errorf("%q: too many colons in address", address)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 0xFFFF || portStr[0] == '+' {
+		return "", 0, fmt.Errorf("%q: invalid port", address)
+	}
+	return host, port, nil
+}
+
+// Listen returns a socket listening on address "host:port". The host is
+// an IP address or a name resolved to its first address, an empty host
+// listens on every address: "[::]" with both IPv4 and IPv6, "0.0.0.0"
+// if IPv6 is not available. The port 0 is a free port chosen by the
+// system, it is in the Addr of the socket returned.
+func (c ListenConfig) Listen(address string) (TCPServer, error) {
+	host, port, err := SplitHostPort(address)
+	if err != nil {
+		return TCPServer{}, err
+	}
+	var s TCPServer
+	if host == "" {
+		ip := IP{0, 0, 0, 0}
+		if ipv6Supported() {
+			ip = make(IP, IPv6len)
+		}
+		s, err = bind(ip, "", port, c)
+	} else {
+		ip, zone := ParseIPZone(host)
+		if ip == nil {
+			ips, lookupErr := LookupIP(host)
+			if lookupErr != nil {
+				return TCPServer{}, lookupErr
+			}
+			ip = ips[0]
+		}
+		s, err = bind(ip, zone, port, c)
+	}
+	if err != nil {
+		return TCPServer{}, err
+	}
+	if err = s.Listen(); err != nil {
+		unix.Close(s.Fd)
+		return TCPServer{}, fmt.Errorf("listen: %s", err.Error())
+	}
+	return s, nil
+}
@@ -0,0 +1,151 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var splitHostPortTests = []struct {
+	address     string // input
+	host        string // expected host
+	port        int    // expected port
+	valid       bool   // expected success
+	testContent string // test details
+}{
+	{"127.0.0.1:8080", "127.0.0.1", 8080, true, "IPv4"},
+	{"[::1]:80", "::1", 80, true, "IPv6"},
+	{"[fe80::1%eth0]:80", "fe80::1%eth0", 80, true, "IPv6 with zone"},
+	{":8080", "", 8080, true, "Empty host"},
+	{"localhost:0", "localhost", 0, true, "Name and port 0"},
+	{"127.0.0.1", "", 0, false, "Missing port"},
+	{"::1:80", "", 0, false, "IPv6 without brackets"},
+	{"[::1:80", "", 0, false, "Missing bracket"},
+	{"127.0.0.1:65536", "", 0, false, "Port too large"},
+	{"127.0.0.1:+80", "", 0, false, "Signed port"},
+	{"127.0.0.1:", "", 0, false, "Empty port"},
+}
+
+func TestSplitHostPort(t *testing.T) {
+	for _, tt := range splitHostPortTests {
+		host, port, err := SplitHostPort(tt.address)
+		if (err == nil) != tt.valid || host != tt.host || port != tt.port {
+			t.Errorf("SplitHostPort(%s): expect %q %d %v, has %q %d %v - Test type: \033[31m%s\033[0m",
+				tt.address, tt.host, tt.port, tt.valid, host, port, err, tt.testContent)
+		}
+	}
+}
+
+// sockPort returns the port of the socket address sa
+func sockPort(sa unix.Sockaddr) int {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return sa.Port
+	case *unix.SockaddrInet6:
+		return sa.Port
+	}
+	return 0
+}
+
+func TestListenConfigOptions(t *testing.T) {
+	config := DefaultListenConfig
+	config.KeepAliveInterval = 5 * time.Second
+	config.KeepAliveCount = 3
+	s, err := config.Listen(":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(s.Fd)
+	port := sockPort(s.Addr)
+	if port == 0 {
+		t.Fatalf("Addr: expect the port chosen, has %s", SockaddrString(s.Addr))
+	}
+	c, err := Connect(IP{127, 0, 0, 1}, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	conn, err := s.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		level, opt  int    // option read on the accepted connection
+		expected    int    // expected value
+		testContent string // test details
+	}{
+		{unix.IPPROTO_TCP, unix.TCP_NODELAY, 1, "TCP_NODELAY"},
+		{unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1, "SO_KEEPALIVE"},
+		{unix.IPPROTO_TCP, tcpKeepIdle, 15, "Keepalive idle time"},
+		{unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, 5, "Keepalive interval"},
+		{unix.IPPROTO_TCP, unix.TCP_KEEPCNT, 3, "Keepalive count"},
+	}
+	for _, tt := range tests {
+		actual, err := unix.GetsockoptInt(conn.Fd, tt.level, tt.opt)
+		ok := actual == tt.expected
+		if tt.expected == 1 {
+			// * The flags can be returned as any non-zero value
+			ok = actual != 0
+		}
+		if err != nil || !ok {
+			t.Errorf("Getsockopt: expect %d, has %d %v - Test type: \033[31m%s\033[0m",
+				tt.expected, actual, err, tt.testContent)
+		}
+	}
+	for _, fd := range []int{s.Fd, conn.Fd} {
+		flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+		if err != nil || flags&unix.FD_CLOEXEC == 0 {
+			t.Errorf("Fcntl: expect FD_CLOEXEC, has %d %v", flags, err)
+		}
+	}
+}
+
+func TestListenConfigReuse(t *testing.T) {
+	// The server closes a connection first, its port is in TIME_WAIT
+	s, err := ListenConfig{ReuseAddr: true}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := sockPort(s.Addr)
+	c, err := Connect(IP{127, 0, 0, 1}, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	unix.Close(s.Fd)
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	address := SockaddrString(s.Addr)
+
+	if s, err = (ListenConfig{}).Listen(address); err == nil {
+		unix.Close(s.Fd)
+		t.Errorf("Listen: expect address already in use - Test type: \033[31m%s\033[0m", "Without SO_REUSEADDR")
+	}
+	s, err = ListenConfig{ReuseAddr: true}.Listen(address)
+	if err != nil {
+		t.Fatalf("Listen: %v - Test type: \033[31m%s\033[0m", err, "SO_REUSEADDR")
+	}
+	defer unix.Close(s.Fd)
+
+	if other, err := (ListenConfig{ReuseAddr: true}).Listen(address); err == nil {
+		unix.Close(other.Fd)
+		t.Errorf("Listen: expect address already in use - Test type: \033[31m%s\033[0m", "Without SO_REUSEPORT")
+	}
+	first, err := ListenConfig{ReusePort: true}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(first.Fd)
+	second, err := ListenConfig{ReusePort: true}.Listen(SockaddrString(first.Addr))
+	if err != nil {
+		t.Fatalf("Listen: %v - Test type: \033[31m%s\033[0m", err, "SO_REUSEPORT")
+	}
+	unix.Close(second.Fd)
+}
@@ -0,0 +1,425 @@
+package net
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Loop multiplexes the connections of a server on a single goroutine with
+// non-blocking sockets, the events of the connections are given to the
+// callbacks of a LoopHandler. The callbacks are called on the goroutine
+// of the loop and must not block.
+type Loop interface {
+	// Run accepts and serves the connections until Stop is called
+	Run() error
+	// Post calls f on the goroutine of the loop, it can be called from
+	// any goroutine. Once Run has returned f is called by Post.
+	Post(f func())
+	// Stop makes Run return once the connections are closed
+	Stop()
+	// Drain stops accepting the connections and closes the idle ones,
+	// the others are closed once not Busy, without data received not
+	// consumed and with their output sent. Run returns once every
+	// connection is closed.
+	Drain()
+}
+
+// LoopHandler are the callbacks of the events of a Loop, nil callbacks
+// are ignored
+type LoopHandler struct {
+	// OnOpen is called once a connection is accepted
+	OnOpen func(c *LoopConn)
+	// OnData is called when data has been received, c.In holds the data
+	// not consumed by the previous calls
+	OnData func(c *LoopConn)
+	// OnClose is called once the connection is closed
+	OnClose func(c *LoopConn)
+	// MaxBuffered stops the reading of a connection once c.In is larger,
+	// OnData is then expected to close it. No limit if 0.
+	MaxBuffered int
+}
+
+// loopReadSize is the size of the buffer used to read the sockets
+const loopReadSize = 64 << 10 // 64 KB
+
+// LoopConn is a connection served by a Loop. It goes through the states:
+// reading, waiting for its handler (Busy), writing the pending output and
+// closed. Its methods must be called on the goroutine of the loop.
+type LoopConn struct {
+	Fd   int
+	Addr unix.Sockaddr
+
+	// In is the data received and not consumed yet
+	In []byte
+	// Busy marks a connection waiting for an answer being computed on
+	// another goroutine, it is not closed by the idle timeout
+	Busy bool
+	// Context stores the data of the protocol served
+	Context interface{}
+	// Deadline closes the connection once passed if it is not Busy,
+	// whatever the data received, the zero time means none
+	Deadline time.Time
+
+	lastActive time.Time
+	out        []byte
+	drained    []func() // called once the output is sent
+	closing    bool     // closed once the output is sent and not Busy
+	closed     bool
+	core       *loopCore
+}
+
+// Write appends data to the output sent to the peer
+func (c *LoopConn) Write(data []byte) {
+	if c.closed {
+		return
+	}
+	c.out = append(c.out, data...)
+	c.core.touch(c)
+}
+
+// Close closes the connection once the pending output is sent and the
+// connection is not Busy
+func (c *LoopConn) Close() {
+	if c.closed {
+		return
+	}
+	c.closing = true
+	c.core.touch(c)
+}
+
+// Closed returns true if the connection is closed
+func (c *LoopConn) Closed() bool {
+	return c.closed
+}
+
+// Buffered returns the size of the output not sent yet
+func (c *LoopConn) Buffered() int {
+	return len(c.out)
+}
+
+// WhenDrained calls f on the goroutine of the loop once the output is
+// sent or the connection closed, now if there is no output
+func (c *LoopConn) WhenDrained(f func()) {
+	if c.closed || len(c.out) == 0 {
+		f()
+		return
+	}
+	c.drained = append(c.drained, f)
+}
+
+// notifyDrained calls the functions waiting for the output to be sent
+func (c *LoopConn) notifyDrained() {
+	drained := c.drained
+	c.drained = nil
+	for _, f := range drained {
+		f()
+	}
+}
+
+// errDetachClosed is returned by Detach for a closed connection
+var errDetachClosed = errors.New("net: detach of a closed connection")
+
+// Detach removes the connection from the loop without closing it, the
+// pending output is sent and the socket is set back to blocking mode.
+// The Conn returned belongs to the caller, c is seen as closed by the
+// loop and OnClose is not called. c.In is kept for the caller.
+func (c *LoopConn) Detach() (Conn, error) {
+	if c.closed {
+		return Conn{}, errDetachClosed
+	}
+	l := c.core
+	c.closed = true
+	delete(l.conns, c.Fd)
+	if l.unregister != nil {
+		l.unregister(c.Fd)
+	}
+	conn := Conn{Fd: c.Fd, Addr: c.Addr}
+	if err := unix.SetNonblock(c.Fd, false); err != nil {
+		conn.Close()
+		return Conn{}, err
+	}
+	if len(c.out) > 0 {
+		if _, err := conn.Write(c.out); err != nil {
+			conn.Close()
+			return Conn{}, err
+		}
+		c.out = nil
+	}
+	c.notifyDrained()
+	return conn, nil
+}
+
+// loopCore is the part of the loops common to the readiness mechanisms
+type loopCore struct {
+	server      TCPServer
+	handler     LoopHandler
+	idleTimeout time.Duration
+
+	conns   map[int]*LoopConn
+	dirty   []*LoopConn // connections with output or closing to handle
+	scratch []byte
+
+	// wake interrupts the wait for events of the loop
+	wake func()
+	// unregister stops the notifications of a detached fd, nil if the
+	// loop does not keep them
+	unregister func(fd int)
+
+	mu       sync.Mutex
+	posted   []func()
+	stopped  bool
+	draining bool
+	exited   bool // set once the connections are closed by shutdown
+}
+
+func newLoopCore(s TCPServer, handler LoopHandler, idleTimeout time.Duration) *loopCore {
+	return &loopCore{
+		server:      s,
+		handler:     handler,
+		idleTimeout: idleTimeout,
+		conns:       map[int]*LoopConn{},
+		scratch:     make([]byte, loopReadSize),
+	}
+}
+
+// Post queues f to be called on the goroutine of the loop
+func (l *loopCore) Post(f func()) {
+	l.mu.Lock()
+	if l.exited {
+		// No more loop, f finds its connection closed
+		l.mu.Unlock()
+		f()
+		return
+	}
+	l.posted = append(l.posted, f)
+	l.mu.Unlock()
+	l.wake()
+}
+
+// Stop makes the loop return
+func (l *loopCore) Stop() {
+	l.mu.Lock()
+	l.stopped = true
+	l.mu.Unlock()
+	l.wake()
+}
+
+// Drain makes the loop return once its connections are closed
+func (l *loopCore) Drain() {
+	l.mu.Lock()
+	l.draining = true
+	l.mu.Unlock()
+	l.wake()
+}
+
+// drained closes the listening socket and the connections which can be
+// closed once Drain has been called, it returns true once every
+// connection is closed
+func (l *loopCore) drained() bool {
+	l.mu.Lock()
+	draining := l.draining
+	l.mu.Unlock()
+	if !draining {
+		return false
+	}
+	if l.server.Fd >= 0 {
+		unix.Close(l.server.Fd)
+		l.server.Fd = -1
+	}
+	for _, c := range l.conns {
+		if !c.Busy && len(c.In) != 0 {
+			// * A message is being received, OnData answers it before
+			// the connection is closed
+			continue
+		}
+		c.closing = true
+		if !c.Busy && !c.pending() {
+			l.closeConn(c)
+		}
+	}
+	return len(l.conns) == 0
+}
+
+func (l *loopCore) isStopped() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stopped
+}
+
+// runPosted calls the functions posted since the last call
+func (l *loopCore) runPosted() {
+	l.mu.Lock()
+	posted := l.posted
+	l.posted = nil
+	l.mu.Unlock()
+	for _, f := range posted {
+		f()
+	}
+	l.flushDirty()
+}
+
+// touch marks c as having output to send or being closed
+func (l *loopCore) touch(c *LoopConn) {
+	l.dirty = append(l.dirty, c)
+}
+
+// open starts serving the connection fd accepted from addr
+func (l *loopCore) open(fd int, addr unix.Sockaddr) *LoopConn {
+	c := &LoopConn{Fd: fd, Addr: addr, lastActive: time.Now(), core: l}
+	l.conns[fd] = c
+	if l.handler.OnOpen != nil {
+		l.handler.OnOpen(c)
+	}
+	return c
+}
+
+// readable reads the data available on c until the socket would block
+func (l *loopCore) readable(c *LoopConn) {
+	var received, eof bool
+	for !c.closed {
+		if max := l.handler.MaxBuffered; max > 0 && len(c.In) > max {
+			// * The data beyond stays in the socket, a fast peer cannot
+			// grow the buffer within one readiness event
+			break
+		}
+		n, err := unix.Read(c.Fd, l.scratch)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EAGAIN {
+			break
+		}
+		if err != nil {
+			l.closeConn(c)
+			return
+		}
+		if n == 0 {
+			// * Read returns 0 when the peer has performed an orderly shutdown
+			eof = true
+			break
+		}
+		c.In = append(c.In, l.scratch[:n]...)
+		received = true
+	}
+	if received {
+		c.lastActive = time.Now()
+		if l.handler.OnData != nil {
+			l.handler.OnData(c)
+		}
+	}
+	if eof {
+		c.Close()
+	}
+	l.flushDirty()
+}
+
+// flush sends the pending output of c until the socket would block,
+// it returns true once everything is sent
+func (l *loopCore) flush(c *LoopConn) bool {
+	for len(c.out) > 0 {
+		n, err := unix.Write(c.Fd, c.out)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EAGAIN {
+			return false
+		}
+		if err != nil {
+			l.closeConn(c)
+			return false
+		}
+		c.out = c.out[n:]
+		c.lastActive = time.Now()
+	}
+	c.out = nil
+	c.notifyDrained()
+	if c.closing && !c.Busy {
+		l.closeConn(c)
+	}
+	return true
+}
+
+// flushDirty sends the output of the connections written since the last
+// call and closes the ones closing
+func (l *loopCore) flushDirty() {
+	for len(l.dirty) > 0 {
+		dirty := l.dirty
+		l.dirty = nil
+		for _, c := range dirty {
+			if !c.closed {
+				l.flush(c)
+			}
+		}
+	}
+}
+
+// writable sends the output of c which would have blocked before
+func (l *loopCore) writable(c *LoopConn) {
+	if !c.closed {
+		l.flush(c)
+	}
+}
+
+// pending returns true if c has output waiting for the socket
+func (c *LoopConn) pending() bool {
+	return len(c.out) > 0
+}
+
+// closeConn closes c now
+func (l *loopCore) closeConn(c *LoopConn) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	unix.Close(c.Fd)
+	delete(l.conns, c.Fd)
+	c.notifyDrained()
+	if l.handler.OnClose != nil {
+		l.handler.OnClose(c)
+	}
+}
+
+// sweep closes the connections idle for longer than the idle timeout and
+// the ones past their deadline
+func (l *loopCore) sweep(now time.Time) {
+	for _, c := range l.conns {
+		if c.Busy || c.pending() {
+			continue
+		}
+		idle := l.idleTimeout > 0 && now.Sub(c.lastActive) > l.idleTimeout
+		if idle || !c.Deadline.IsZero() && now.After(c.Deadline) {
+			l.closeConn(c)
+		}
+	}
+}
+
+// shutdown closes the connections and the listening socket, the
+// functions posted are called with their connection closed
+func (l *loopCore) shutdown() {
+	for _, c := range l.conns {
+		l.closeConn(c)
+	}
+	if l.server.Fd >= 0 {
+		unix.Close(l.server.Fd)
+	}
+	l.mu.Lock()
+	l.exited = true
+	l.mu.Unlock()
+	l.runPosted()
+}
+
+// acceptError returns the error to return from Run for an accept error,
+// nil if the loop can continue
+func acceptError(err error) error {
+	switch err {
+	case unix.EAGAIN, unix.EINTR, unix.ECONNABORTED:
+		return nil
+	case unix.EMFILE, unix.ENFILE:
+		// Out of fds, the connection stays in the queue until some are closed
+		return nil
+	}
+	return err
+}
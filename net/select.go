@@ -0,0 +1,190 @@
+package net
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// selectTick is the maximum time waited for events, the idle connections
+// are closed at this interval or at half the idle timeout if shorter
+const selectTick = time.Second
+
+// errFdSetSize is returned when the listening socket cannot be selected
+var errFdSetSize = errors.New("net: fd too large for select")
+
+// SelectLoop is a Loop using select(2), available on every unix. The fd
+// sets are rebuilt from the peers before each call: the read set holds
+// every socket and the write set only the connections with pending
+// output. It is limited to FD_SETSIZE fds, the connections accepted
+// beyond are closed.
+type SelectLoop struct {
+	*loopCore
+
+	peers *FDAddr // client fd -> peer address
+	wakeR int     // read end of the pipe written by Post and Stop
+	wakeW int
+}
+
+// NewSelectLoop returns a loop serving the connections accepted by the
+// listening socket s, the connections idle for longer than idleTimeout
+// are closed, 0 means no timeout
+func NewSelectLoop(s TCPServer, handler LoopHandler, idleTimeout time.Duration) (*SelectLoop, error) {
+	if s.Fd >= unix.FD_SETSIZE {
+		return nil, errFdSetSize
+	}
+	var p [2]int
+	if err := pipeCloexec(p[:]); err != nil {
+		return nil, err
+	}
+	l := &SelectLoop{
+		loopCore: newLoopCore(s, handler, idleTimeout),
+		peers:    FDAddrInit(),
+		wakeR:    p[0],
+		wakeW:    p[1],
+	}
+	l.wake = l.wakeUp
+	var err error
+	for _, fd := range []int{p[0], p[1], s.Fd} {
+		if err == nil {
+			err = unix.SetNonblock(fd, true)
+		}
+	}
+	if err == nil && l.wakeR >= unix.FD_SETSIZE {
+		err = errFdSetSize
+	}
+	if err != nil {
+		l.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// wakeUp interrupts Select, the pipe is drained by the loop
+func (l *SelectLoop) wakeUp() {
+	unix.Write(l.wakeW, []byte{0})
+}
+
+func (l *SelectLoop) close() {
+	unix.Close(l.wakeR)
+	unix.Close(l.wakeW)
+}
+
+// accept accepts the pending connections until the queue is empty
+func (l *SelectLoop) accept() error {
+	for {
+		fd, addr, err := acceptCloexec(l.server.Fd, l.server.config.CloseOnExec)
+		if err != nil {
+			return acceptError(err)
+		}
+		if fd >= unix.FD_SETSIZE {
+			// * FDSet would write out of the set
+			unix.Close(fd)
+			continue
+		}
+		if err = l.server.setConnOptions(fd); err == nil {
+			err = unix.SetNonblock(fd, true)
+		}
+		if err != nil {
+			unix.Close(fd)
+			continue
+		}
+		l.peers.Set(fd, addr)
+		l.open(fd, addr)
+	}
+}
+
+// drainWake empties the wake-up pipe
+func (l *SelectLoop) drainWake() {
+	var buf [64]byte
+	for {
+		if n, _ := unix.Read(l.wakeR, buf[:]); n < len(buf) {
+			return
+		}
+	}
+}
+
+// fdSets fills the fd sets waited by Select and returns the highest fd,
+// the peers of the connections closed since the last call are forgotten
+func (l *SelectLoop) fdSets(rset, wset *unix.FdSet) int {
+	FDZero(rset)
+	FDZero(wset)
+	FDSet(l.wakeR, rset)
+	maxFd := l.wakeR
+	if l.server.Fd >= 0 {
+		// * The listening socket is closed once draining
+		FDSet(l.server.Fd, rset)
+		if l.server.Fd > maxFd {
+			maxFd = l.server.Fd
+		}
+	}
+	for fd := range *l.peers {
+		c, ok := l.conns[fd]
+		if !ok {
+			l.peers.Clr(fd)
+			continue
+		}
+		FDSet(fd, rset)
+		if c.pending() {
+			FDSet(fd, wset)
+		}
+		if fd > maxFd {
+			maxFd = fd
+		}
+	}
+	return maxFd
+}
+
+// Run accepts and serves the connections until Stop is called
+func (l *SelectLoop) Run() error {
+	defer l.close()
+	defer l.shutdown()
+
+	tick := selectTick
+	if l.idleTimeout > 0 && l.idleTimeout/2 < tick {
+		tick = l.idleTimeout / 2
+	}
+	var rset, wset unix.FdSet
+	lastSweep := time.Now()
+	for !l.isStopped() {
+		maxFd := l.fdSets(&rset, &wset)
+		timeout := unix.NsecToTimeval(tick.Nanoseconds())
+		_, err := unix.Select(maxFd+1, &rset, &wset, nil, &timeout)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if FDIsSet(l.wakeR, &rset) {
+			l.drainWake()
+			l.runPosted()
+		}
+		if l.server.Fd >= 0 && FDIsSet(l.server.Fd, &rset) {
+			if err := l.accept(); err != nil {
+				return err
+			}
+		}
+		for fd := range *l.peers {
+			c, ok := l.conns[fd]
+			if !ok {
+				continue
+			}
+			if FDIsSet(fd, &rset) {
+				l.readable(c)
+			}
+			if FDIsSet(fd, &wset) {
+				l.writable(c)
+			}
+		}
+		if now := time.Now(); now.Sub(lastSweep) >= tick {
+			l.sweep(now)
+			lastSweep = now
+		}
+		if l.drained() {
+			return nil
+		}
+	}
+	return nil
+}
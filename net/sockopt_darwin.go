@@ -0,0 +1,6 @@
+package net
+
+import "golang.org/x/sys/unix"
+
+// tcpKeepIdle is the option of the idle time before the keepalive probes
+const tcpKeepIdle = unix.TCP_KEEPALIVE
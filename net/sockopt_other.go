@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package net
+
+import "golang.org/x/sys/unix"
+
+// tcpKeepIdle is the option of the idle time before the keepalive probes
+const tcpKeepIdle = unix.TCP_KEEPIDLE
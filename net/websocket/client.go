@@ -0,0 +1,155 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"../http"
+)
+
+// ErrBadHandshake is returned by Dial when the response of the server is
+// not a valid opening handshake
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// Dialer opens WebSocket connections, its zero value uses the
+// http.DefaultClient without subprotocol nor compression
+type Dialer struct {
+	// Client sends the opening handshake, http.DefaultClient if nil
+	Client *http.Client
+	// Subprotocols are requested to the server in order of preference
+	Subprotocols []string
+	// EnableCompression offers the permessage-deflate extension
+	EnableCompression bool
+	// ReadLimit is the maximum size of a message, DefaultReadLimit if 0
+	ReadLimit int64
+}
+
+// newKey returns a random Sec-WebSocket-Key - RFC 6455, 4.1
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// handshakeURL returns the HTTP URL of the ws or wss URL rawurl
+// - RFC 6455, 3
+func handshakeURL(rawurl string) (string, error) {
+	scheme, rest, ok := strings.Cut(rawurl, "://")
+	if !ok {
+		return "", errors.New("websocket: missing scheme in " + rawurl)
+	}
+	switch strings.ToLower(scheme) {
+	case "ws":
+		scheme = "http"
+	case "wss":
+		scheme = "https"
+	default:
+		return "", errors.New("websocket: unsupported scheme " + scheme)
+	}
+	// * Fragment identifiers are meaningless in WebSocket URIs
+	if strings.Contains(rest, "#") {
+		return "", errors.New("websocket: fragment in " + rawurl)
+	}
+	return scheme + "://" + rest, nil
+}
+
+// checkResponse returns ErrBadHandshake if resp does not accept the
+// opening handshake req sent with key - RFC 6455, 4.1
+func (d *Dialer) checkResponse(req *http.Request, resp *http.Response, key string) error {
+	if !resp.Header.HasToken(http.Upgrade, "websocket") || !resp.Header.HasToken(http.Connection, "upgrade") {
+		return ErrBadHandshake
+	}
+	if resp.Header.Get(secWebSocketAccept) != computeAccept(key) {
+		return ErrBadHandshake
+	}
+	if subprotocol := resp.Header.Get(secWebSocketProtocol); subprotocol != "" {
+		offered := false
+		for _, s := range req.Header.List(secWebSocketProtocol) {
+			offered = offered || s == subprotocol
+		}
+		if !offered {
+			return ErrBadHandshake
+		}
+	}
+	for _, ext := range parseExtensions(resp.Header.List(secWebSocketExtensions)) {
+		if !d.EnableCompression || ext.name != deflateExtension {
+			return ErrBadHandshake
+		}
+		// * Without context takeover on both sides, the window is not limited
+		_, noContext := ext.params["server_no_context_takeover"]
+		_, windowBits := ext.params["client_max_window_bits"]
+		if !noContext || windowBits {
+			return ErrBadHandshake
+		}
+	}
+	return nil
+}
+
+// Dial performs the opening handshake with the server at the ws or wss
+// URL rawurl, with the additional headers header, and returns the
+// WebSocket connection. The headers of the handshake set by Dial cannot
+// be given, the subprotocols of header are offered before Subprotocols.
+// The response of the server is returned with the handshake errors.
+func (d *Dialer) Dial(rawurl string, header http.Header) (*Conn, *http.Response, error) {
+	target, err := handshakeURL(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		switch http.CanonicalHeaderKey(name) {
+		case string(http.Upgrade), string(http.Connection), secWebSocketKey, secWebSocketVersion, secWebSocketExtensions:
+			// * They are set by the handshake, a duplicate would be ambiguous
+			return nil, nil, errors.New("websocket: the " + name + " header is set by Dial")
+		}
+		req.Header.AddHeaders(name, values)
+	}
+	key, err := newKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set(http.Upgrade, "websocket")
+	req.Header.Set(http.Connection, "Upgrade")
+	req.Header.Set(secWebSocketVersion, "13")
+	req.Header.Set(secWebSocketKey, key)
+	// The subprotocols of the header given are offered too
+	if len(d.Subprotocols) > 0 {
+		req.Header.Add(secWebSocketProtocol, strings.Join(d.Subprotocols, ", "))
+	}
+	if d.EnableCompression {
+		req.Header.Set(secWebSocketExtensions, deflateResponse)
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, conn, buffered, err := client.Upgrade(&req)
+	if err != nil {
+		return nil, resp, err
+	}
+	if err := d.checkResponse(&req, resp, key); err != nil {
+		conn.Close()
+		return nil, resp, err
+	}
+
+	c := newConn(conn, buffered, false)
+	c.subprotocol = resp.Header.Get(secWebSocketProtocol)
+	c.compress = resp.Header.Get(secWebSocketExtensions) != ""
+	if d.ReadLimit > 0 {
+		c.readLimit = d.ReadLimit
+	}
+	return c, resp, nil
+}
+
+// Dial performs the opening handshake with the default Dialer
+func Dial(rawurl string, header http.Header) (*Conn, *http.Response, error) {
+	return (&Dialer{}).Dial(rawurl, header)
+}
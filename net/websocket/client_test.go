@@ -0,0 +1,258 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	gonet "net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"../../tlsutil"
+	"../http"
+)
+
+// startServer serves router with listenAndServe on a free port and
+// returns its address once it accepts connections
+func startServer(t *testing.T, router *http.Router, listenAndServe func(srv *http.Server) error) (*http.Server, string) {
+	srv := &http.Server{Addr: "127.0.0.1:" + strconv.Itoa(freePort(t)), Router: router}
+	go listenAndServe(srv)
+	for i := 0; i < 100; i++ {
+		if conn, err := gonet.Dial("tcp", srv.Addr); err == nil {
+			conn.Close()
+			return srv, srv.Addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the server does not accept connections")
+	return nil, ""
+}
+
+// newClientRouter answers /echo with an echo connection and /close with
+// a connection closed by the server with the code 4001
+func newClientRouter(upgrader *Upgrader) *http.Router {
+	router := newEchoRouter(upgrader)
+	router.GET("/close", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		go func() {
+			conn.WriteClose(4001, "bye")
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return router
+}
+
+func TestDial(t *testing.T) {
+	upgrader := &Upgrader{Subprotocols: []string{"chat"}, EnableCompression: true}
+	srv, addr := startServer(t, newClientRouter(upgrader), (*http.Server).ListenAndServe)
+	defer srv.Shutdown(context.Background())
+
+	tests := []struct {
+		dialer      *Dialer
+		subprotocol string // subprotocol selected
+		compressed  bool   // compression negotiated
+		testContent string // test details
+	}{
+		{&Dialer{}, "", false, "Default dialer"},
+		{&Dialer{EnableCompression: true}, "", true, "Compression"},
+		{&Dialer{Subprotocols: []string{"v2", "chat"}}, "chat", false, "Subprotocol"},
+		{&Dialer{Subprotocols: []string{"v2"}}, "", false, "Subprotocol not supported"},
+	}
+	for _, tt := range tests {
+		conn, resp, err := tt.dialer.Dial("ws://"+addr+"/echo", nil)
+		if err != nil {
+			t.Errorf("Dial: expect no error, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			continue
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("Status: expect %d, has %d - Test type: \033[31m%s\033[0m", http.StatusSwitchingProtocols, resp.StatusCode, tt.testContent)
+		}
+		if conn.Subprotocol() != tt.subprotocol || conn.Compressed() != tt.compressed {
+			t.Errorf("Negotiation: expect %q %v, has %q %v - Test type: \033[31m%s\033[0m", tt.subprotocol, tt.compressed, conn.Subprotocol(), conn.Compressed(), tt.testContent)
+		}
+		var pong string
+		conn.SetPongHandler(func(data []byte) error {
+			pong = string(data)
+			return nil
+		})
+		conn.WritePing([]byte("ping"))
+		for _, expect := range []string{"hello", strings.Repeat("long ", 10000)} {
+			conn.WriteMessage(TextMessage, []byte(expect))
+			if messageType, data, err := conn.ReadMessage(); err != nil || messageType != TextMessage || string(data) != expect {
+				t.Errorf("Echo: expect %.20q, has %.20q %v - Test type: \033[31m%s\033[0m", expect, data, err, tt.testContent)
+			}
+		}
+		if pong != "ping" {
+			t.Errorf("Pong: expect %q, has %q - Test type: \033[31m%s\033[0m", "ping", pong, tt.testContent)
+		}
+		conn.WriteClose(CloseNormalClosure, "")
+		if _, _, err := conn.ReadMessage(); err == nil || err.(*CloseError).Code != CloseNormalClosure {
+			t.Errorf("Close: expect %d, has %v - Test type: \033[31m%s\033[0m", CloseNormalClosure, err, tt.testContent)
+		}
+	}
+
+	// The keys of the headers given are canonicalized
+	header := http.Header{"sec-websocket-protocol": {"chat"}, "origin": {"http://" + addr}}
+	conn, resp, err := Dial("ws://"+addr+"/echo", header)
+	if err != nil {
+		t.Fatalf("Dial with headers: %v", err)
+	}
+	if conn.Subprotocol() != "chat" || resp.Request.Header.Get(origin) != "http://"+addr {
+		t.Errorf("Dial with headers: expect chat and the origin sent, has %q %q", conn.Subprotocol(), resp.Request.Header.Get(origin))
+	}
+	conn.Close()
+
+	conn, _, err = Dial("ws://"+addr+"/close", http.Header{})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if e, ok := err.(*CloseError); !ok || e.Code != 4001 || e.Text != "bye" {
+		t.Errorf("Close code: expect 4001 bye, has %v", err)
+	}
+	if err = conn.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+		t.Errorf("Write after close: expect %v, has %v", ErrCloseSent, err)
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	ca, err := tlsutil.NewCA("Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Issue([]string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err = cert.WriteFiles(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	srv, addr := startServer(t, newClientRouter(&Upgrader{}), func(srv *http.Server) error {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	})
+	defer srv.Shutdown(context.Background())
+
+	if _, _, err := Dial("wss://"+addr+"/echo", nil); err == nil {
+		t.Errorf("Dial: expect an unknown authority error, has no error")
+	}
+	dialer := &Dialer{Client: &http.Client{TLSConfig: &tls.Config{RootCAs: ca.CertPool()}}}
+	conn, resp, err := dialer.Dial("wss://"+addr+"/echo", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if resp.TLS == nil {
+		t.Errorf("TLS: expect a connection state, has nil")
+	}
+	conn.WriteMessage(BinaryMessage, []byte{0, 1, 2})
+	if messageType, data, err := conn.ReadMessage(); err != nil || messageType != BinaryMessage || string(data) != "\x00\x01\x02" {
+		t.Errorf("Echo: expect %q, has %q %v", "\x00\x01\x02", data, err)
+	}
+}
+
+// serveHandshake answers the first connection to a local listener with
+// the response returned by respond for the key of the request
+func serveHandshake(t *testing.T, respond func(key string) string) string {
+	l, err := gonet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		br := bufio.NewReader(conn)
+		key := ""
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			if name, value, _ := strings.Cut(line, ":"); strings.EqualFold(name, secWebSocketKey) {
+				key = strings.TrimSpace(value)
+			}
+		}
+		conn.Write([]byte(respond(key)))
+		// * Wait for the client to close the connection
+		br.ReadByte()
+	}()
+	return l.Addr().String()
+}
+
+func TestDialErrors(t *testing.T) {
+	switching := func(headers string) func(key string) string {
+		return func(key string) string {
+			return "HTTP/1.1 101 Switching Protocols\r\n" + strings.ReplaceAll(headers, "ACCEPT", computeAccept(key)) + "\r\n"
+		}
+	}
+	tests := []struct {
+		dialer      *Dialer
+		respond     func(key string) string // response of the server
+		expect      error                   // error returned by Dial
+		testContent string                  // test details
+	}{
+		{&Dialer{}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\n"),
+			nil, "Valid handshake"},
+		{&Dialer{}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n"),
+			ErrBadHandshake, "Wrong accept"},
+		{&Dialer{}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\n"),
+			ErrBadHandshake, "Missing accept"},
+		{&Dialer{}, switching("Connection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\n"),
+			ErrBadHandshake, "Missing upgrade"},
+		{&Dialer{}, switching("Upgrade: h2c\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\n"),
+			ErrBadHandshake, "Other upgrade"},
+		{&Dialer{Subprotocols: []string{"chat"}}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\nSec-WebSocket-Protocol: v2\r\n"),
+			ErrBadHandshake, "Subprotocol not requested"},
+		{&Dialer{}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\nSec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover\r\n"),
+			ErrBadHandshake, "Compression not offered"},
+		{&Dialer{EnableCompression: true}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\nSec-WebSocket-Extensions: permessage-deflate\r\n"),
+			ErrBadHandshake, "Compression with context takeover"},
+		{&Dialer{EnableCompression: true}, switching("Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ACCEPT\r\nSec-WebSocket-Extensions: x-unknown\r\n"),
+			ErrBadHandshake, "Unknown extension"},
+		{&Dialer{}, func(string) string { return "HTTP/1.1 403 Forbidden\r\nContent-Length: 9\r\n\r\nForbidden" },
+			http.ErrNotUpgraded, "Refused"},
+	}
+	for _, tt := range tests {
+		addr := serveHandshake(t, tt.respond)
+		conn, resp, err := tt.dialer.Dial("ws://"+addr+"/", nil)
+		if err != tt.expect {
+			t.Errorf("Dial: expect %v, has %v - Test type: \033[31m%s\033[0m", tt.expect, err, tt.testContent)
+		}
+		if resp == nil {
+			t.Errorf("Response: expect the response of the server, has nil - Test type: \033[31m%s\033[0m", tt.testContent)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	for _, rawurl := range []string{"http://localhost/", "localhost/", "ws://localhost/#fragment"} {
+		if _, _, err := Dial(rawurl, nil); err == nil {
+			t.Errorf("Dial: expect an error, has no error - Test type: \033[31m%s\033[0m", rawurl)
+		}
+	}
+	for _, name := range []string{"upgrade", "Connection", "sec-websocket-key", "Sec-WebSocket-Version", "sec-websocket-extensions"} {
+		if _, _, err := Dial("ws://localhost/", http.Header{name: {"x"}}); err == nil {
+			t.Errorf("Dial: expect an error, has no error - Test type: \033[31m%s header\033[0m", name)
+		}
+	}
+}
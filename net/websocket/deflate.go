@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Compression Extensions for WebSocket - RFC 7692
+// Only permessage-deflate without context takeover is negotiated: each
+// message is compressed on its own, no memory is kept between messages.
+
+const deflateExtension = "permessage-deflate"
+
+// deflateTail ends the data of a flush, removed from the messages sent
+// and added back to the messages received - RFC 7692, 7.2.1
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+var flateWriterPool = sync.Pool{New: func() interface{} {
+	w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return w
+}}
+
+// compress returns the payload of a compressed message
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+// decompress returns the data of a compressed message, ErrReadLimit if
+// it is larger than limit
+func decompress(data []byte, limit int64) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail))
+	r := flate.NewReader(src)
+	defer r.Close()
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(io.LimitReader(r, limit+1))
+	// * The tail ends the data with a sync flush, not with the final block
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if int64(buf.Len()) > limit {
+		return nil, ErrReadLimit
+	}
+	return buf.Bytes(), nil
+}
+
+// extension is an element of the Sec-WebSocket-Extensions header
+type extension struct {
+	name   string
+	params map[string]string // parameter -> value, "" if none
+}
+
+// parseExtensions parses the elements of the Sec-WebSocket-Extensions
+// header - RFC 6455, 9.1
+func parseExtensions(elements []string) []extension {
+	var extensions []extension
+	for _, element := range elements {
+		parts := strings.Split(element, ";")
+		ext := extension{name: strings.TrimSpace(parts[0]), params: map[string]string{}}
+		for _, param := range parts[1:] {
+			key, value, _ := strings.Cut(param, "=")
+			ext.params[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// acceptDeflateOffer returns true if the offer of the client can be
+// accepted without context takeover - RFC 7692, 7.1
+func acceptDeflateOffer(ext extension) bool {
+	if ext.name != deflateExtension {
+		return false
+	}
+	for key, value := range ext.params {
+		switch key {
+		case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+		case "server_max_window_bits":
+			// * The compressor always uses a window of 2^15 bytes
+			if value != "15" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// deflateResponse is the extension answered to an accepted offer
+const deflateResponse = deflateExtension + "; server_no_context_takeover; client_no_context_takeover"
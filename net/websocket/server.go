@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"../http"
+)
+
+// Headers of the opening handshake - RFC 6455, 11.3
+const (
+	secWebSocketKey        = "Sec-WebSocket-Key"
+	secWebSocketAccept     = "Sec-WebSocket-Accept"
+	secWebSocketVersion    = "Sec-WebSocket-Version"
+	secWebSocketProtocol   = "Sec-WebSocket-Protocol"
+	secWebSocketExtensions = "Sec-WebSocket-Extensions"
+	origin                 = "Origin"
+)
+
+// acceptGUID is concatenated to the key of the client to compute the
+// accept value of the server - RFC 6455, 1.3
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// computeAccept returns the Sec-WebSocket-Accept value of key
+func computeAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// validKey returns true if key is 16 bytes encoded in base64
+func validKey(key string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(decoded) == 16
+}
+
+// HandshakeError is returned by Upgrade when the request is not a valid
+// WebSocket opening handshake, the error has been answered to the client
+type HandshakeError struct {
+	Status int
+	Text   string
+}
+
+func (e *HandshakeError) Error() string {
+	return "websocket: " + e.Text
+}
+
+// Upgrader upgrades the HTTP connections to the WebSocket protocol, its
+// zero value accepts the requests of the same origin without subprotocol
+// nor compression
+type Upgrader struct {
+	// Subprotocols are the subprotocols supported by the server, the first
+	// one requested by the client is selected
+	Subprotocols []string
+	// CheckOrigin returns false to refuse the request with 403 Forbidden,
+	// if nil the requests with an Origin header whose host is not the Host
+	// of the request are refused
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression accepts the permessage-deflate extension
+	EnableCompression bool
+	// ReadLimit is the maximum size of a message, DefaultReadLimit if 0
+	ReadLimit int64
+}
+
+// sameOrigin returns true if the request has no Origin header or an
+// origin whose host is the Host of the request - RFC 6455, 10.2
+// The default port of the scheme of the origin is ignored on both sides.
+func sameOrigin(r *http.Request) bool {
+	value := r.Header.Get(origin)
+	if value == "" {
+		return true
+	}
+	u, err := http.ParseURL(value)
+	if err != nil {
+		return false
+	}
+	port := ":80"
+	if strings.EqualFold(u.Scheme, "https") || strings.EqualFold(u.Scheme, "wss") {
+		port = ":443"
+	}
+	return strings.EqualFold(strings.TrimSuffix(u.HostPort(), port), strings.TrimSuffix(r.Host, port))
+}
+
+// selectSubprotocol returns the first subprotocol requested by the client
+// supported by the server
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	for _, requested := range r.Header.List(secWebSocketProtocol) {
+		for _, supported := range u.Subprotocols {
+			if requested == supported {
+				return supported
+			}
+		}
+	}
+	return ""
+}
+
+// checkRequest returns an error if r is not a valid opening handshake
+// - RFC 6455, 4.2.1
+func (u *Upgrader) checkRequest(r *http.Request) *HandshakeError {
+	if r.Method != "GET" {
+		return &HandshakeError{http.StatusMethodNotAllowed, "the method of the handshake is not GET"}
+	}
+	if r.ProtoMajor < 1 || r.ProtoMajor == 1 && r.ProtoMinor < 1 {
+		return &HandshakeError{http.StatusBadRequest, "the handshake requires HTTP/1.1"}
+	}
+	if !r.Header.HasToken(http.Connection, "upgrade") || !r.Header.HasToken(http.Upgrade, "websocket") {
+		return &HandshakeError{http.StatusBadRequest, "missing upgrade to websocket"}
+	}
+	if r.Header.Get(secWebSocketVersion) != "13" {
+		return &HandshakeError{http.StatusUpgradeRequired, "unsupported version"}
+	}
+	if !validKey(r.Header.Get(secWebSocketKey)) {
+		return &HandshakeError{http.StatusBadRequest, "invalid " + secWebSocketKey}
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return &HandshakeError{http.StatusForbidden, "origin not allowed"}
+	}
+	return nil
+}
+
+// Upgrade performs the opening handshake of the request r received by a
+// handler and returns the WebSocket connection, the handler must not use
+// w after. The invalid requests are answered with an error status code.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if e := u.checkRequest(r); e != nil {
+		if e.Status == http.StatusUpgradeRequired {
+			w.Header().Set(secWebSocketVersion, "13")
+		}
+		w.Header().Set(http.ContentType, "text/plain; charset=utf-8")
+		w.WriteHeader(e.Status)
+		w.Write([]byte(e.Text + "\n"))
+		return nil, e
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, errors.New("websocket: the ResponseWriter does not implement http.Hijacker")
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+	compress := false
+	if u.EnableCompression {
+		for _, ext := range parseExtensions(r.Header.List(secWebSocketExtensions)) {
+			if acceptDeflateOffer(ext) {
+				compress = true
+				break
+			}
+		}
+	}
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		secWebSocketAccept + ": " + computeAccept(r.Header.Get(secWebSocketKey)) + "\r\n"
+	if subprotocol != "" {
+		response += secWebSocketProtocol + ": " + subprotocol + "\r\n"
+	}
+	if compress {
+		response += secWebSocketExtensions + ": " + deflateResponse + "\r\n"
+	}
+	if _, err = conn.Write([]byte(response + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := newConn(conn, buffered, true)
+	c.subprotocol = subprotocol
+	c.compress = compress
+	if u.ReadLimit > 0 {
+		c.readLimit = u.ReadLimit
+	}
+	return c, nil
+}
+
+// Upgrade performs the opening handshake with the default Upgrader
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	return (&Upgrader{}).Upgrade(w, r)
+}
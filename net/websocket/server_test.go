@@ -0,0 +1,305 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	gonet "net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"../http"
+)
+
+// hijackRecorder is a ResponseWriter recording the response, Hijack
+// returns one end of a pipe
+type hijackRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	conn   gonet.Conn
+}
+
+func (w *hijackRecorder) Header() http.Header  { return w.header }
+func (w *hijackRecorder) WriteHeader(code int) { w.status = code }
+func (w *hijackRecorder) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+func (w *hijackRecorder) Hijack() (gonet.Conn, []byte, error) {
+	return w.conn, nil, nil
+}
+
+// newUpgradeRequest returns a valid opening handshake from
+// http://example.com to ws://example.com/chat
+func newUpgradeRequest() *http.Request {
+	r, _ := http.NewRequest("GET", "example.com/chat", nil)
+	r.Header.AddHeader("Upgrade", "websocket")
+	r.Header.AddHeader("Connection", "keep-alive, Upgrade")
+	r.Header.AddHeader(secWebSocketKey, "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.AddHeader(secWebSocketVersion, "13")
+	r.Header.AddHeader(origin, "http://example.com")
+	return &r
+}
+
+func TestComputeAccept(t *testing.T) {
+	// Example of RFC 6455, 1.3
+	if accept := computeAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("computeAccept: expect %s, has %s", "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", accept)
+	}
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	tests := []struct {
+		change      func(r *http.Request) // change of the valid request
+		status      int                   // status code answered
+		testContent string                // test details
+	}{
+		{func(r *http.Request) { r.Method = "POST" }, http.StatusMethodNotAllowed, "POST request"},
+		{func(r *http.Request) { r.ProtoMinor = 0 }, http.StatusBadRequest, "HTTP/1.0"},
+		{func(r *http.Request) { r.Header.Del("Upgrade") }, http.StatusBadRequest, "Missing Upgrade"},
+		{func(r *http.Request) { r.Header.Set("Connection", "keep-alive") }, http.StatusBadRequest, "Missing Connection: Upgrade"},
+		{func(r *http.Request) { r.Header.Set(secWebSocketVersion, "8") }, http.StatusUpgradeRequired, "Old version"},
+		{func(r *http.Request) { r.Header.Set(secWebSocketKey, "c2hvcnQ=") }, http.StatusBadRequest, "Key of 5 bytes"},
+		{func(r *http.Request) { r.Header.Del(secWebSocketKey) }, http.StatusBadRequest, "Missing key"},
+		{func(r *http.Request) { r.Header.Set(origin, "http://evil.com") }, http.StatusForbidden, "Other origin"},
+		{func(r *http.Request) { r.Header.Set(origin, "null") }, http.StatusForbidden, "Opaque origin"},
+	}
+	for _, tt := range tests {
+		r := newUpgradeRequest()
+		tt.change(r)
+		w := &hijackRecorder{header: http.Header{}}
+		conn, err := Upgrade(w, r)
+		if err == nil {
+			conn.Close()
+			t.Errorf("Upgrade: expect an error - Test type: \033[31m%s\033[0m", tt.testContent)
+			continue
+		}
+		if w.status != tt.status {
+			t.Errorf("Status: expect %d, has %d - Test type: \033[31m%s\033[0m", tt.status, w.status, tt.testContent)
+		}
+		if e, ok := err.(*HandshakeError); !ok || e.Status != tt.status {
+			t.Errorf("Error: expect a HandshakeError %d, has %v - Test type: \033[31m%s\033[0m", tt.status, err, tt.testContent)
+		}
+	}
+	w := &hijackRecorder{header: http.Header{}}
+	r := newUpgradeRequest()
+	r.Header.Set(secWebSocketVersion, "8")
+	Upgrade(w, r)
+	if version := w.header.Get(secWebSocketVersion); version != "13" {
+		t.Errorf("Sec-WebSocket-Version: expect 13, has %q", version)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin      string // Origin header
+		host        string // Host header
+		expected    bool   // origin allowed
+		testContent string // test details
+	}{
+		{"http://example.com", "example.com", true, "Same host"},
+		{"HTTP://Example.com", "example.com", true, "Case"},
+		{"http://example.com:80", "example.com", true, "Default port in the origin"},
+		{"https://example.com", "example.com:443", true, "Default port in the host"},
+		{"http://[::1]", "[::1]:80", true, "IPv6 with the default port"},
+		{"http://example.com:8080", "example.com:8080", true, "Same port"},
+		{"http://example.com:8080", "example.com", false, "Other port"},
+		{"https://example.com", "example.com:80", false, "Default port of another scheme"},
+		{"http://evil.com", "example.com", false, "Other host"},
+	}
+	for _, tt := range tests {
+		r := newUpgradeRequest()
+		r.Header.Set(origin, tt.origin)
+		r.Host = tt.host
+		if actual := sameOrigin(r); actual != tt.expected {
+			t.Errorf("sameOrigin: expect %v, has %v - Test type: \033[31m%s\033[0m", tt.expected, actual, tt.testContent)
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		upgrader    Upgrader              // upgrader of the server
+		change      func(r *http.Request) // change of the valid request
+		subprotocol string                // subprotocol selected
+		compress    bool                  // permessage-deflate negotiated
+		testContent string                // test details
+	}{
+		{Upgrader{}, func(r *http.Request) {}, "", false, "Default"},
+		{Upgrader{}, func(r *http.Request) { r.Header.Del(origin) }, "", false, "Without origin"},
+		{Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}, func(r *http.Request) { r.Header.Set(origin, "http://other.com") }, "", false, "Any origin"},
+		{Upgrader{Subprotocols: []string{"chat", "superchat"}}, func(r *http.Request) {
+			r.Header.AddHeader(secWebSocketProtocol, "v2.chat, superchat")
+			r.Header.AddHeader(secWebSocketProtocol, "chat")
+		}, "superchat", false, "Subprotocol of the client order"},
+		{Upgrader{Subprotocols: []string{"chat"}}, func(r *http.Request) { r.Header.AddHeader(secWebSocketProtocol, "other") }, "", false, "No common subprotocol"},
+		{Upgrader{EnableCompression: true}, func(r *http.Request) {
+			r.Header.AddHeader(secWebSocketExtensions, "permessage-deflate; client_max_window_bits")
+		}, "", true, "Compression"},
+		{Upgrader{EnableCompression: true}, func(r *http.Request) {
+			r.Header.AddHeader(secWebSocketExtensions, "permessage-deflate; server_max_window_bits=10, permessage-deflate")
+		}, "", true, "Second offer accepted"},
+		{Upgrader{EnableCompression: true}, func(r *http.Request) {
+			r.Header.AddHeader(secWebSocketExtensions, "permessage-deflate; server_max_window_bits=10, x-webkit-deflate-frame")
+		}, "", false, "No acceptable offer"},
+		{Upgrader{}, func(r *http.Request) {
+			r.Header.AddHeader(secWebSocketExtensions, "permessage-deflate")
+		}, "", false, "Compression disabled"},
+	}
+	for _, tt := range tests {
+		r := newUpgradeRequest()
+		tt.change(r)
+		s, c := gonet.Pipe()
+		w := &hijackRecorder{header: http.Header{}, conn: s}
+		type result struct {
+			conn *Conn
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			conn, err := tt.upgrader.Upgrade(w, r)
+			done <- result{conn, err}
+		}()
+
+		br := bufio.NewReader(c)
+		status, _ := br.ReadString('\n')
+		header := http.Header{}
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			key, value, _ := strings.Cut(strings.TrimSpace(line), ": ")
+			header.AddHeader(key, value)
+		}
+		res := <-done
+		if res.err != nil {
+			t.Errorf("Upgrade: expect nil, has %v - Test type: \033[31m%s\033[0m", res.err, tt.testContent)
+			c.Close()
+			continue
+		}
+		if status != "HTTP/1.1 101 Switching Protocols\r\n" {
+			t.Errorf("Status: expect 101, has %q - Test type: \033[31m%s\033[0m", status, tt.testContent)
+		}
+		if accept := header.Get(secWebSocketAccept); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("Accept: expect s3pPLMBiTxaQ9kYGzzhZRbK+xOo=, has %q - Test type: \033[31m%s\033[0m", accept, tt.testContent)
+		}
+		if protocol := header.Get(secWebSocketProtocol); protocol != tt.subprotocol || res.conn.Subprotocol() != tt.subprotocol {
+			t.Errorf("Subprotocol: expect %q, has %q - Test type: \033[31m%s\033[0m", tt.subprotocol, protocol, tt.testContent)
+		}
+		if compressed := header.Get(secWebSocketExtensions) != ""; compressed != tt.compress || res.conn.Compressed() != tt.compress {
+			t.Errorf("Compression: expect %v, has %v - Test type: \033[31m%s\033[0m", tt.compress, compressed, tt.testContent)
+		}
+		res.conn.Close()
+	}
+}
+
+// freePort returns a local port free for a short time
+func freePort(t *testing.T) int {
+	l, err := gonet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*gonet.TCPAddr).Port
+}
+
+// newEchoRouter answers /echo with a WebSocket connection echoing the
+// messages until the close handshake
+func newEchoRouter(upgrader *Upgrader) *http.Router {
+	router := http.NewRouter()
+	router.GET("/echo", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				messageType, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				if err = conn.WriteMessage(messageType, data); err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return router
+}
+
+func TestServeWebSocket(t *testing.T) {
+	modes := []struct {
+		mode        http.ServeMode // mode of the server
+		testContent string         // test details
+	}{
+		{http.ModeGoroutine, "Goroutine"},
+		{http.ModeEpoll, "Epoll"},
+		{http.ModeSelect, "Select"},
+	}
+	for _, tt := range modes {
+		port := freePort(t)
+		srv := &http.Server{
+			Addr:   "127.0.0.1:" + strconv.Itoa(port),
+			Router: newEchoRouter(&Upgrader{EnableCompression: true}),
+			Config: http.ServerConfig{Mode: tt.mode},
+		}
+		errc := make(chan error, 1)
+		go func() { errc <- srv.ListenAndServe() }()
+
+		var conn gonet.Conn
+		var err error
+		for i := 0; i < 100; i++ {
+			if conn, err = gonet.Dial("tcp", srv.Addr); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		// The first message is sent with the handshake
+		request := "GET /echo HTTP/1.1\r\nHost: " + srv.Addr + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" +
+			"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n"
+		first := frame(finBit|TextMessage, []byte("first"), true)
+		conn.Write(append([]byte(request), first...))
+		br := bufio.NewReader(conn)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Handshake: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			}
+			if line == "\r\n" {
+				break
+			}
+		}
+		buffered, _ := br.Peek(br.Buffered())
+		client := newConn(conn, buffered, false)
+		client.compress = true
+
+		messages := []string{"first", "second", strings.Repeat("long ", 10000)}
+		for i, expect := range messages {
+			if i > 0 {
+				if err := client.WriteMessage(TextMessage, []byte(expect)); err != nil {
+					t.Errorf("WriteMessage: %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+				}
+			}
+			if _, data, err := client.ReadMessage(); err != nil || string(data) != expect {
+				t.Errorf("Echo: expect %.20q, has %.20q %v - Test type: \033[31m%s\033[0m", expect, data, err, tt.testContent)
+			}
+		}
+		client.WriteClose(CloseNormalClosure, "")
+		if _, _, err := client.ReadMessage(); err == nil || err.(*CloseError).Code != CloseNormalClosure {
+			t.Errorf("Close: expect %d, has %v - Test type: \033[31m%s\033[0m", CloseNormalClosure, err, tt.testContent)
+		}
+		srv.Shutdown(context.Background())
+		if err := <-errc; err != http.ErrServerClosed {
+			t.Errorf("ListenAndServe: expect %v, has %v - Test type: \033[31m%s\033[0m", http.ErrServerClosed, err, tt.testContent)
+		}
+	}
+}
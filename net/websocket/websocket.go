@@ -0,0 +1,578 @@
+// Package websocket implements the WebSocket protocol - RFC 6455, with
+// the permessage-deflate extension - RFC 7692.
+//
+// A Conn is used by a goroutine reading the messages with ReadMessage and
+// by any goroutine writing with WriteMessage, WritePing or WriteClose.
+// The control frames are handled by ReadMessage: a ping is answered with
+// a pong and a close frame is answered with a close frame. The close
+// handshake is started by WriteClose, ReadMessage then returns a
+// *CloseError once the peer has answered and the connection is closed.
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	gonet "net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Types of message - RFC 6455, 11.8
+const (
+	continuationFrame = 0
+	TextMessage       = 1
+	BinaryMessage     = 2
+	CloseMessage      = 8
+	PingMessage       = 9
+	PongMessage       = 10
+)
+
+// Close status codes - RFC 6455, 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005 // never sent, no code in the close frame
+	CloseAbnormalClosure         = 1006 // never sent, connection closed without close frame
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	// DefaultReadLimit is the maximum size of a message received
+	DefaultReadLimit = 16 << 20 // 16 MB
+	// maxControlPayload is the maximum payload of a control frame
+	maxControlPayload = 125
+	// closeTimeout is the time given to the peer to answer a close frame
+	// sent because of an error
+	closeTimeout = time.Second
+)
+
+// Bits of the first two bytes of a frame - RFC 6455, 5.2
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+	maskBit = 0x80
+)
+
+var (
+	// ErrCloseSent is returned when writing after a close frame
+	ErrCloseSent = errors.New("websocket: close sent")
+	// ErrReadLimit is returned when a message is larger than the limit
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+)
+
+// CloseError is returned by ReadMessage once a close frame has been
+// received, Code is CloseNoStatusReceived if the frame has no code
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// protocolError is the error of a frame violating the protocol, the
+// connection is failed with its code
+type protocolError struct {
+	code int
+	text string
+}
+
+func (e *protocolError) Error() string {
+	return "websocket: " + e.text
+}
+
+// Conn is a WebSocket connection
+type Conn struct {
+	conn        gonet.Conn
+	br          *bufio.Reader
+	isServer    bool
+	subprotocol string
+	compress    bool // permessage-deflate negotiated
+
+	// Read state, used by the goroutine of ReadMessage
+	readLimit   int64
+	readErr     error
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+
+	writeMu      sync.Mutex
+	closeSent    bool
+	fragmentSize int
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newConn returns a connection reading first the data already buffered
+func newConn(conn gonet.Conn, buffered []byte, isServer bool) *Conn {
+	var src io.Reader = conn
+	if len(buffered) != 0 {
+		src = io.MultiReader(bytes.NewReader(append([]byte{}, buffered...)), conn)
+	}
+	c := &Conn{
+		conn:      conn,
+		br:        bufio.NewReader(src),
+		isServer:  isServer,
+		readLimit: DefaultReadLimit,
+	}
+	c.pingHandler = func(data []byte) error {
+		err := c.WritePong(data)
+		if err == ErrCloseSent {
+			// * The pong is not needed once the connection is closing
+			return nil
+		}
+		return err
+	}
+	return c
+}
+
+// Subprotocol returns the subprotocol negotiated, "" if none
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed returns true if permessage-deflate has been negotiated
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+// LocalAddr returns the local address of the connection
+func (c *Conn) LocalAddr() gonet.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() gonet.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of ReadMessage
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the writes
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadLimit sets the maximum size of a message received, the
+// connection is closed with CloseMessageTooBig beyond
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetFragmentSize makes WriteMessage split the messages larger than size
+// in frames of size bytes, 0 sends each message in a single frame
+func (c *Conn) SetFragmentSize(size int) {
+	c.writeMu.Lock()
+	c.fragmentSize = size
+	c.writeMu.Unlock()
+}
+
+// SetPingHandler sets the function called by ReadMessage with the data
+// of a ping, the default handler answers with a pong
+func (c *Conn) SetPingHandler(h func(data []byte) error) {
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the function called by ReadMessage with the data
+// of a pong, the pongs are ignored by default
+func (c *Conn) SetPongHandler(h func(data []byte) error) {
+	c.pongHandler = h
+}
+
+// Close closes the underlying connection without close handshake
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
+
+// frameHeader is the header of a frame - RFC 6455, 5.2
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	opcode int
+	length int64
+	masked bool
+	mask   [4]byte
+}
+
+// isControl returns true for the close, ping and pong frames
+func isControl(opcode int) bool {
+	return opcode >= CloseMessage
+}
+
+// readHeader reads and checks the header of the next frame
+func (c *Conn) readHeader() (frameHeader, error) {
+	var h frameHeader
+	var b [8]byte
+	if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&finBit != 0
+	h.rsv1 = b[0]&rsv1Bit != 0
+	h.opcode = int(b[0] & 0x0F)
+	h.masked = b[1]&maskBit != 0
+	h.length = int64(b[1] & 0x7F)
+
+	switch h.opcode {
+	case continuationFrame, TextMessage, BinaryMessage, CloseMessage, PingMessage, PongMessage:
+	default:
+		return h, &protocolError{CloseProtocolError, "unknown opcode " + strconv.Itoa(h.opcode)}
+	}
+	if b[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return h, &protocolError{CloseProtocolError, "unexpected reserved bits"}
+	}
+	// * RSV1 marks the first frame of a compressed message - RFC 7692, 6
+	if h.rsv1 && (!c.compress || h.opcode == continuationFrame || isControl(h.opcode)) {
+		return h, &protocolError{CloseProtocolError, "unexpected reserved bits"}
+	}
+	// * The frames of the client are masked, the ones of the server are
+	// not - RFC 6455, 5.1
+	if h.masked != c.isServer {
+		return h, &protocolError{CloseProtocolError, "invalid frame masking"}
+	}
+
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, b[:8]); err != nil {
+			return h, err
+		}
+		length := binary.BigEndian.Uint64(b[:8])
+		if length>>63 != 0 {
+			return h, &protocolError{CloseProtocolError, "invalid frame length"}
+		}
+		h.length = int64(length)
+	}
+	if isControl(h.opcode) && (!h.fin || h.length > maxControlPayload) {
+		// * The control frames are not fragmented - RFC 6455, 5.5
+		return h, &protocolError{CloseProtocolError, "invalid control frame"}
+	}
+	if h.masked {
+		if _, err := io.ReadFull(c.br, h.mask[:]); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// maskBytes applies the masking key to data - RFC 6455, 5.3
+func maskBytes(mask [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+}
+
+// readPayload reads the payload of the frame h
+func (c *Conn) readPayload(h frameHeader) ([]byte, error) {
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if h.masked {
+		maskBytes(h.mask, payload)
+	}
+	return payload, nil
+}
+
+// ReadMessage returns the type and the data of the next text or binary
+// message, the control frames received before are handled. Once an error
+// is returned the next calls return it.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, data, err := c.readMessage()
+	if err != nil {
+		c.readErr = err
+		if e, ok := err.(*protocolError); ok {
+			c.fail(e.code, e.text)
+		} else if _, ok := err.(*CloseError); !ok {
+			c.Close()
+		}
+		return 0, nil, err
+	}
+	return messageType, data, nil
+}
+
+func (c *Conn) readMessage() (int, []byte, error) {
+	messageType := 0
+	compressed := false
+	var data []byte
+	for {
+		h, err := c.readHeader()
+		if err != nil {
+			return 0, nil, err
+		}
+		if isControl(h.opcode) {
+			payload, err := c.readPayload(h)
+			if err != nil {
+				return 0, nil, err
+			}
+			if err = c.handleControl(h.opcode, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		// * A fragmented message is a first frame followed by continuation
+		// frames, the last one with FIN - RFC 6455, 5.4
+		if h.opcode == continuationFrame && messageType == 0 {
+			return 0, nil, &protocolError{CloseProtocolError, "continuation frame without message"}
+		}
+		if h.opcode != continuationFrame {
+			if messageType != 0 {
+				return 0, nil, &protocolError{CloseProtocolError, "new message before the end of the fragmented message"}
+			}
+			messageType = h.opcode
+			compressed = h.rsv1
+		}
+		if int64(len(data))+h.length > c.readLimit {
+			return 0, nil, &protocolError{CloseMessageTooBig, "read limit exceeded"}
+		}
+		payload, err := c.readPayload(h)
+		if err != nil {
+			return 0, nil, err
+		}
+		data = append(data, payload...)
+		if h.fin {
+			break
+		}
+	}
+	if compressed {
+		var err error
+		if data, err = decompress(data, c.readLimit); err == ErrReadLimit {
+			return 0, nil, &protocolError{CloseMessageTooBig, "read limit exceeded"}
+		} else if err != nil {
+			return 0, nil, &protocolError{CloseInvalidFramePayloadData, "invalid compressed data"}
+		}
+	}
+	if messageType == TextMessage && !utf8.Valid(data) {
+		return 0, nil, &protocolError{CloseInvalidFramePayloadData, "invalid UTF-8 in text message"}
+	}
+	return messageType, data, nil
+}
+
+// validCloseCode returns true for the codes which can be received in a
+// close frame - RFC 6455, 7.4
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		// Registered by the libraries and the applications, private use
+		return true
+	}
+	return false
+}
+
+// handleControl handles a close, ping or pong frame
+func (c *Conn) handleControl(opcode int, payload []byte) error {
+	switch opcode {
+	case PingMessage:
+		if c.pingHandler != nil {
+			return c.pingHandler(payload)
+		}
+	case PongMessage:
+		if c.pongHandler != nil {
+			return c.pongHandler(payload)
+		}
+	case CloseMessage:
+		closeErr := &CloseError{Code: CloseNoStatusReceived}
+		if len(payload) == 1 {
+			return &protocolError{CloseProtocolError, "invalid close frame"}
+		}
+		if len(payload) >= 2 {
+			closeErr.Code = int(binary.BigEndian.Uint16(payload))
+			closeErr.Text = string(payload[2:])
+			if !validCloseCode(closeErr.Code) {
+				return &protocolError{CloseProtocolError, "invalid close code " + strconv.Itoa(closeErr.Code)}
+			}
+			if !utf8.ValidString(closeErr.Text) {
+				return &protocolError{CloseInvalidFramePayloadData, "invalid UTF-8 in close frame"}
+			}
+		}
+		// * The close frame is answered with the same code, the handshake is
+		// then complete and the connection is closed - RFC 6455, 5.5.1
+		echo := closeErr.Code
+		if echo == CloseNoStatusReceived {
+			echo = 0
+		}
+		c.writeClose(echo, "")
+		c.Close()
+		return closeErr
+	}
+	return nil
+}
+
+// fail sends a close frame with code and closes the connection, the
+// close frame of the peer is waited for a short time - RFC 6455, 7.1.7
+func (c *Conn) fail(code int, text string) {
+	if err := c.writeClose(code, text); err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		io.Copy(io.Discard, io.LimitReader(c.br, maxControlPayload+16))
+	}
+	c.Close()
+}
+
+// newMaskKey returns a random masking key
+func newMaskKey() [4]byte {
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		panic(fmt.Sprintf("websocket: masking key: %v", err))
+	}
+	return key
+}
+
+// writeFrame sends a frame, c.writeMu must be held
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode int, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := byte(opcode)
+	if fin {
+		b0 |= finBit
+	}
+	if rsv1 {
+		b0 |= rsv1Bit
+	}
+	buf = append(buf, b0)
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		buf = append(buf, b1|byte(length))
+	case length <= 0xFFFF:
+		buf = append(buf, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(length))
+	default:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+	start := len(buf)
+	if !c.isServer {
+		mask := newMaskKey()
+		buf = append(buf, mask[:]...)
+		start = len(buf)
+		buf = append(buf, payload...)
+		maskBytes(mask, buf[start:])
+	} else {
+		buf = append(buf, payload...)
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// WriteMessage sends a text or binary message, compressed if
+// permessage-deflate has been negotiated, split in frames if a fragment
+// size is set
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("websocket: invalid message type " + strconv.Itoa(messageType))
+	}
+	compressed := false
+	if c.compress {
+		var err error
+		if data, err = compress(data); err != nil {
+			return err
+		}
+		compressed = true
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	opcode := messageType
+	for {
+		fragment := data
+		if c.fragmentSize > 0 && len(fragment) > c.fragmentSize {
+			fragment = data[:c.fragmentSize]
+		}
+		data = data[len(fragment):]
+		fin := len(data) == 0
+		if err := c.writeFrame(fin, compressed, opcode, fragment); err != nil {
+			return err
+		}
+		if fin {
+			return nil
+		}
+		opcode = continuationFrame
+		compressed = false
+	}
+}
+
+// writeControl sends a control frame
+func (c *Conn) writeControl(opcode int, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return errors.New("websocket: control frame payload too large")
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+	return c.writeFrame(true, false, opcode, payload)
+}
+
+// WritePing sends a ping, data is at most 125 bytes
+func (c *Conn) WritePing(data []byte) error {
+	return c.writeControl(PingMessage, data)
+}
+
+// WritePong sends a pong, data is at most 125 bytes
+func (c *Conn) WritePong(data []byte) error {
+	return c.writeControl(PongMessage, data)
+}
+
+// writeClose sends a close frame, without payload if code is 0
+func (c *Conn) writeClose(code int, text string) error {
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, text...)
+	}
+	return c.writeControl(CloseMessage, payload)
+}
+
+// WriteClose starts the close handshake with code and a reason of at
+// most 123 bytes, the messages can then only be read until ReadMessage
+// returns the *CloseError of the peer
+func (c *Conn) WriteClose(code int, text string) error {
+	if !validCloseCode(code) {
+		return errors.New("websocket: invalid close code " + strconv.Itoa(code))
+	}
+	if len(text) > maxControlPayload-2 {
+		return errors.New("websocket: close reason too long")
+	}
+	return c.writeClose(code, text)
+}
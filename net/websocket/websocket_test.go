@@ -0,0 +1,297 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	gonet "net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPipe returns the server and the client of an in-memory connection
+func newPipe(compress bool) (*Conn, *Conn) {
+	s, c := gonet.Pipe()
+	server, client := newConn(s, nil, true), newConn(c, nil, false)
+	server.compress, client.compress = compress, compress
+	return server, client
+}
+
+// frame returns a frame whose first byte is b0, masked if mask is set
+func frame(b0 byte, payload []byte, mask bool) []byte {
+	var buf []byte
+	buf = append(buf, b0)
+	var b1 byte
+	if mask {
+		b1 = maskBit
+	}
+	switch {
+	case len(payload) <= 125:
+		buf = append(buf, b1|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		buf = append(buf, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)))
+	default:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	}
+	if mask {
+		key := [4]byte{1, 2, 3, 4}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+		return buf
+	}
+	return append(buf, payload...)
+}
+
+// readServerFrame reads a small unmasked frame, the frames of the opcode
+// skip are ignored
+func readServerFrame(r io.Reader, skip int) (byte, []byte, error) {
+	for {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return 0, nil, err
+		}
+		payload := make([]byte, head[1]&0x7F)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, nil, err
+		}
+		if int(head[0]&0x0F) != skip {
+			return head[0], payload, nil
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	large := bytes.Repeat([]byte("websocket "), 7000)
+	tests := []struct {
+		messageType  int    // type of the message
+		data         []byte // data of the message
+		fragmentSize int    // fragment size of the sender
+		compress     bool   // permessage-deflate negotiated
+		testContent  string // test details
+	}{
+		{TextMessage, []byte("hello"), 0, false, "Small text"},
+		{BinaryMessage, []byte{0, 1, 2, 255}, 0, false, "Binary"},
+		{TextMessage, []byte{}, 0, false, "Empty message"},
+		{BinaryMessage, large[:126], 0, false, "16 bits length"},
+		{BinaryMessage, large[:0xFFFF], 0, false, "Largest 16 bits length"},
+		{BinaryMessage, large, 0, false, "64 bits length"},
+		{TextMessage, large, 1000, false, "Fragmented"},
+		{TextMessage, []byte("héllo wörld"), 3, false, "UTF-8 split between fragments"},
+		{TextMessage, large, 0, true, "Compressed"},
+		{TextMessage, []byte{}, 0, true, "Compressed empty message"},
+		{BinaryMessage, large, 100, true, "Compressed and fragmented"},
+	}
+	for _, tt := range tests {
+		server, client := newPipe(tt.compress)
+		for _, sender := range []*Conn{client, server} {
+			receiver := client
+			if sender == client {
+				receiver = server
+			}
+			sender.SetFragmentSize(tt.fragmentSize)
+			errc := make(chan error, 1)
+			go func() { errc <- sender.WriteMessage(tt.messageType, tt.data) }()
+			messageType, data, err := receiver.ReadMessage()
+			if err != nil {
+				t.Errorf("ReadMessage: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+				break
+			}
+			if err = <-errc; err != nil {
+				t.Errorf("WriteMessage: expect nil, has %v - Test type: \033[31m%s\033[0m", err, tt.testContent)
+			}
+			if messageType != tt.messageType || !bytes.Equal(data, tt.data) {
+				t.Errorf("Message: expect %d %.20q, has %d %.20q - Test type: \033[31m%s\033[0m", tt.messageType, tt.data, messageType, data, tt.testContent)
+			}
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestCompressedFrame(t *testing.T) {
+	s, c := gonet.Pipe()
+	defer s.Close()
+	server := newConn(s, nil, true)
+	server.compress = true
+	data := bytes.Repeat([]byte("compress "), 100)
+	go server.WriteMessage(TextMessage, data)
+
+	head := make([]byte, 2)
+	io.ReadFull(c, head)
+	if head[0] != finBit|rsv1Bit|TextMessage {
+		t.Errorf("First byte: expect %#x, has %#x", finBit|rsv1Bit|TextMessage, head[0])
+	}
+	payload := make([]byte, head[1])
+	io.ReadFull(c, payload)
+	if len(payload) >= len(data) {
+		t.Errorf("Payload: expect compressed, has %d bytes", len(payload))
+	}
+	if decompressed, err := decompress(payload, DefaultReadLimit); err != nil || !bytes.Equal(decompressed, data) {
+		t.Errorf("decompress: expect the message, has %v", err)
+	}
+	bomb, _ := compress(make([]byte, 1<<20))
+	if _, err := decompress(bomb, 1000); err != ErrReadLimit {
+		t.Errorf("decompress: expect %v, has %v", ErrReadLimit, err)
+	}
+}
+
+func TestInvalidFrames(t *testing.T) {
+	ping := frame(finBit|PingMessage, []byte("ping"), true)
+	tests := []struct {
+		frames      [][]byte // frames sent by the client
+		compress    bool     // permessage-deflate negotiated
+		readLimit   int64    // read limit of the server, default if 0
+		code        int      // close code answered by the server
+		testContent string   // test details
+	}{
+		{[][]byte{frame(finBit|TextMessage, []byte("hi"), false)}, false, 0, CloseProtocolError, "Unmasked client frame"},
+		{[][]byte{frame(finBit|rsv2Bit|TextMessage, []byte("hi"), true)}, false, 0, CloseProtocolError, "RSV2 set"},
+		{[][]byte{frame(finBit|rsv1Bit|TextMessage, []byte("hi"), true)}, false, 0, CloseProtocolError, "RSV1 without compression"},
+		{[][]byte{frame(finBit|rsv1Bit|PingMessage, nil, true)}, true, 0, CloseProtocolError, "RSV1 on a control frame"},
+		{[][]byte{frame(finBit|3, []byte("hi"), true)}, false, 0, CloseProtocolError, "Reserved opcode"},
+		{[][]byte{frame(PingMessage, []byte("hi"), true)}, false, 0, CloseProtocolError, "Fragmented ping"},
+		{[][]byte{frame(finBit|PingMessage, make([]byte, 126), true)}, false, 0, CloseProtocolError, "Ping too large"},
+		{[][]byte{frame(finBit|continuationFrame, []byte("hi"), true)}, false, 0, CloseProtocolError, "Continuation without message"},
+		{[][]byte{frame(TextMessage, []byte("a"), true), frame(finBit|TextMessage, []byte("b"), true)}, false, 0, CloseProtocolError, "New message inside a fragmented message"},
+		{[][]byte{frame(finBit|TextMessage, []byte{0xff, 0xfe}, true)}, false, 0, CloseInvalidFramePayloadData, "Invalid UTF-8"},
+		{[][]byte{frame(TextMessage, []byte("a"), true), ping, frame(finBit|continuationFrame, []byte{0xc3}, true)}, false, 0, CloseInvalidFramePayloadData, "Truncated UTF-8 after a ping"},
+		{[][]byte{frame(finBit|BinaryMessage, make([]byte, 11), true)}, false, 10, CloseMessageTooBig, "Message too big"},
+		{[][]byte{frame(BinaryMessage, make([]byte, 6), true), frame(finBit|continuationFrame, make([]byte, 6), true)}, false, 10, CloseMessageTooBig, "Fragments too big"},
+		{[][]byte{frame(finBit|rsv1Bit|BinaryMessage, []byte{0xff, 0xff}, true)}, true, 0, CloseInvalidFramePayloadData, "Invalid compressed data"},
+		{[][]byte{frame(finBit|CloseMessage, []byte{3}, true)}, false, 0, CloseProtocolError, "Close payload of 1 byte"},
+		{[][]byte{frame(finBit|CloseMessage, []byte{0x03, 0xed}, true)}, false, 0, CloseProtocolError, "Close code 1005 sent"},
+		{[][]byte{frame(finBit|CloseMessage, []byte{0x03, 0xe8, 0xff}, true)}, false, 0, CloseInvalidFramePayloadData, "Invalid UTF-8 close reason"},
+	}
+	for _, tt := range tests {
+		s, c := gonet.Pipe()
+		server := newConn(s, nil, true)
+		server.compress = tt.compress
+		if tt.readLimit != 0 {
+			server.SetReadLimit(tt.readLimit)
+		}
+		errc := make(chan error, 1)
+		go func() {
+			_, _, err := server.ReadMessage()
+			errc <- err
+		}()
+		go func() {
+			for _, f := range tt.frames {
+				if _, err := c.Write(f); err != nil {
+					return
+				}
+			}
+		}()
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if b0, payload, err := readServerFrame(c, PongMessage); err != nil {
+			t.Errorf("Close frame: expect code %d, has %v - Test type: \033[31m%s\033[0m", tt.code, err, tt.testContent)
+		} else if b0 != finBit|CloseMessage || len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != tt.code {
+			t.Errorf("Close frame: expect code %d, has %#x %q - Test type: \033[31m%s\033[0m", tt.code, b0, payload, tt.testContent)
+		}
+		c.Close()
+		if err := <-errc; err == nil {
+			t.Errorf("ReadMessage: expect an error - Test type: \033[31m%s\033[0m", tt.testContent)
+		} else if _, _, again := server.ReadMessage(); again != err {
+			t.Errorf("ReadMessage: expect the same error, has %v - Test type: \033[31m%s\033[0m", again, tt.testContent)
+		}
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	server, client := newPipe(false)
+	defer server.Close()
+	defer client.Close()
+	pongs := make(chan string, 1)
+	client.SetPongHandler(func(data []byte) error {
+		pongs <- string(data)
+		return nil
+	})
+	go func() {
+		// The server answers the ping while reading the next message
+		if _, data, err := server.ReadMessage(); err == nil {
+			server.WriteMessage(TextMessage, data)
+		}
+	}()
+	if err := client.WritePing([]byte("are you there")); err != nil {
+		t.Fatal(err)
+	}
+	go client.WriteMessage(TextMessage, []byte("after ping"))
+	if _, data, err := client.ReadMessage(); err != nil || string(data) != "after ping" {
+		t.Errorf("ReadMessage: expect %q, has %q %v", "after ping", data, err)
+	}
+	select {
+	case pong := <-pongs:
+		if pong != "are you there" {
+			t.Errorf("Pong: expect %q, has %q", "are you there", pong)
+		}
+	default:
+		t.Error("Pong: expect the pong before the message")
+	}
+	if err := client.WritePing(make([]byte, 126)); err == nil {
+		t.Error("WritePing: expect an error for 126 bytes")
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	tests := []struct {
+		code        int    // code sent by the client
+		text        string // reason sent by the client
+		expect      int    // code received by the server
+		testContent string // test details
+	}{
+		{CloseNormalClosure, "bye", CloseNormalClosure, "Normal closure"},
+		{CloseGoingAway, "", CloseGoingAway, "Without reason"},
+		{4000, "application", 4000, "Private code"},
+	}
+	for _, tt := range tests {
+		server, client := newPipe(false)
+		serverErr := make(chan error, 1)
+		go func() {
+			_, _, err := server.ReadMessage()
+			serverErr <- err
+		}()
+		if err := client.WriteClose(tt.code, tt.text); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+			t.Errorf("WriteMessage: expect %v, has %v - Test type: \033[31m%s\033[0m", ErrCloseSent, err, tt.testContent)
+		}
+		_, _, err := client.ReadMessage()
+		if e, ok := err.(*CloseError); !ok || e.Code != tt.code {
+			t.Errorf("Client: expect the close %d echoed, has %v - Test type: \033[31m%s\033[0m", tt.code, err, tt.testContent)
+		}
+		err = <-serverErr
+		if e, ok := err.(*CloseError); !ok || e.Code != tt.expect || e.Text != tt.text {
+			t.Errorf("Server: expect close %d %q, has %v - Test type: \033[31m%s\033[0m", tt.expect, tt.text, err, tt.testContent)
+		}
+		if err := server.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+			t.Errorf("Server WriteMessage: expect %v, has %v - Test type: \033[31m%s\033[0m", ErrCloseSent, err, tt.testContent)
+		}
+	}
+
+	// A close frame without code is answered without code
+	s, c := gonet.Pipe()
+	server := newConn(s, nil, true)
+	go c.Write(frame(finBit|CloseMessage, nil, true))
+	go func() {
+		head := make([]byte, 2)
+		io.ReadFull(c, head)
+	}()
+	if _, _, err := server.ReadMessage(); err == nil || err.(*CloseError).Code != CloseNoStatusReceived {
+		t.Errorf("Empty close: expect %d, has %v", CloseNoStatusReceived, err)
+	}
+
+	_, client := newPipe(false)
+	for _, code := range []int{999, CloseNoStatusReceived, CloseAbnormalClosure, 1015, 2000, 5000} {
+		if err := client.WriteClose(code, ""); err == nil {
+			t.Errorf("WriteClose(%d): expect an error", code)
+		}
+	}
+	if err := client.WriteClose(CloseNormalClosure, strings.Repeat("x", 124)); err == nil {
+		t.Error("WriteClose: expect an error for a reason of 124 bytes")
+	}
+}
@@ -0,0 +1,193 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	gonet "net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"../net"
+)
+
+// Generation of the certificates used to test TLS locally: a CA is
+// created once, its certificate is trusted by the clients and it signs
+// the certificates of the servers.
+
+// DefaultValidity is the validity of the certificates generated
+const DefaultValidity = 365 * 24 * time.Hour
+
+// Cert is a certificate with its private key
+type Cert struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// serialNumber returns a random serial number - RFC 5280, 4.1.2.2
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// create signs template with the key of parent, the certificate is self
+// signed if parent is nil
+func create(template *x509.Certificate, parent *Cert) (*Cert, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if template.SerialNumber, err = serialNumber(); err != nil {
+		return nil, err
+	}
+	// * The certificate is valid from a few minutes ago to accept the
+	// clocks slightly late
+	template.NotBefore = time.Now().Add(-5 * time.Minute)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Cert{Cert: cert, Key: key}, nil
+}
+
+// NewCA creates a self signed certificate authority, validFor is
+// DefaultValidity if 0
+func NewCA(commonName string, validFor time.Duration) (*Cert, error) {
+	if validFor <= 0 {
+		validFor = DefaultValidity
+	}
+	return create(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"ImpetusResel development CA"}},
+		NotAfter:              time.Now().Add(validFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}, nil)
+}
+
+// Issue creates a certificate signed by ca for the hosts, host names or
+// IP addresses, usable by a server and by a client. The first host is the
+// common name, validFor is DefaultValidity if 0.
+func (ca *Cert) Issue(hosts []string, validFor time.Duration) (*Cert, error) {
+	if !ca.Cert.IsCA {
+		return nil, errors.New("tlsutil: the issuer is not a CA")
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("tlsutil: no host given")
+	}
+	if validFor <= 0 {
+		validFor = DefaultValidity
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0]},
+		NotAfter:    time.Now().Add(validFor),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip, _ := net.ParseIPZone(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, gonet.IP(ip))
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		// A certificate cannot outlive its issuer
+		template.NotAfter = ca.Cert.NotAfter
+	}
+	return create(template, ca)
+}
+
+// CertPEM returns the certificate PEM encoded
+func (c *Cert) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// KeyPEM returns the private key PEM encoded in PKCS #8
+func (c *Cert) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// WriteFiles writes the certificate and the private key to PEM files, the
+// key file is only readable by its owner
+func (c *Cert) WriteFiles(certFile, keyFile string) error {
+	keyPEM, err := c.KeyPEM()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(certFile, c.CertPEM(), 0644); err != nil {
+		return err
+	}
+	return writePrivateFile(keyFile, keyPEM)
+}
+
+// writePrivateFile writes data to a file only readable by its owner. An
+// existing file keeps its mode with os.WriteFile, data is written to a new
+// temporary file which replaces it.
+func writePrivateFile(name string, data []byte) error {
+	// * CreateTemp creates the file with the mode 0600
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// TLSCertificate returns the certificate for a tls.Config
+func (c *Cert) TLSCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.Cert.Raw}, PrivateKey: c.Key, Leaf: c.Cert}
+}
+
+// CertPool returns a pool trusting the certificate, used as
+// tls.Config.RootCAs or ClientCAs with a CA
+func (c *Cert) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.Cert)
+	return pool
+}
+
+// LoadFiles reads a certificate and its ECDSA private key from PEM files
+func LoadFiles(certFile, keyFile string) (*Cert, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("tlsutil: the private key is not an ECDSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &Cert{Cert: cert, Key: key}, nil
+}
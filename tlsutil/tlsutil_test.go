@@ -0,0 +1,106 @@
+package tlsutil
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	ca, err := NewCA("Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Issue([]string{"localhost", "127.0.0.1", "::1", "*.example.com"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Cert.NotAfter.Equal(ca.Cert.NotAfter) {
+		t.Errorf("NotAfter: expect %v, has %v", ca.Cert.NotAfter, cert.Cert.NotAfter)
+	}
+	tests := []struct {
+		name        string // name verified
+		valid       bool   // expected result
+		testContent string // test details
+	}{
+		{"localhost", true, "Host name"},
+		{"127.0.0.1", true, "IPv4 address"},
+		{"::1", true, "IPv6 address"},
+		{"www.example.com", true, "Wildcard"},
+		{"example.com", false, "Wildcard parent"},
+		{"127.0.0.2", false, "Other IP address"},
+	}
+	for _, tt := range tests {
+		_, err := cert.Cert.Verify(x509.VerifyOptions{
+			DNSName:   tt.name,
+			Roots:     ca.CertPool(),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if (err == nil) != tt.valid {
+			t.Errorf("Verify: expect %v, has %v - Test type: \033[31m%s\033[0m", tt.valid, err, tt.testContent)
+		}
+	}
+
+	if _, err := cert.Issue([]string{"localhost"}, 0); err == nil {
+		t.Error("Issue by a leaf: expect an error")
+	}
+	if _, err := ca.Issue(nil, 0); err == nil {
+		t.Error("Issue without host: expect an error")
+	}
+}
+
+func TestWriteLoadFiles(t *testing.T) {
+	ca, err := NewCA("Test CA", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if err = ca.WriteFiles(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFiles(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Cert.Equal(ca.Cert) || !loaded.Key.Equal(ca.Key) {
+		t.Error("LoadFiles: expect the certificate written")
+	}
+	if _, err = loaded.Issue([]string{"localhost"}, 0); err != nil {
+		t.Errorf("Issue by the loaded CA: %v", err)
+	}
+	if _, err = LoadFiles(certFile, certFile); err == nil {
+		t.Error("LoadFiles without key: expect an error")
+	}
+}
+
+func TestWriteFilesKeyMode(t *testing.T) {
+	ca, err := NewCA("Test CA", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	// A key file readable by everyone is replaced
+	if err = os.WriteFile(keyFile, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ca.WriteFiles(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Key file: expect mode %o, has %o", 0600, mode)
+	}
+	if _, err = LoadFiles(certFile, keyFile); err != nil {
+		t.Errorf("LoadFiles: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 2 {
+		t.Errorf("ReadDir: expect only the certificate and the key, has %d files", len(files))
+	}
+}